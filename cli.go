@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"lazy-topology/topology"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+)
+
+const CliName = "lazy-topology"
+const ExitOk = 0
+const ExitError = 1
+const ExitUsage = 2
+const ExitChanged = 3 // diff found changes
+const NoLockFile = "none"
+
+// Returned by diff when a render would change the deploy folder
+var errChanged = errors.New("deploy folder would change")
+
+type Command struct {
+	Name        string
+	Description string
+	// Registers command specific flags, working path flags are registered for all commands
+	Flags func(flags *flag.FlagSet)
+	Run   func(ctx topology.TopologyContext) error
+}
+
+var cleanVendor bool
+var diffNamesOnly bool
+var portsJson bool
+
+func commands() []Command {
+	return []Command{
+		{
+			Name:        "render",
+			Description: "render the topology into the deploy folder",
+			Run:         runRender,
+		},
+		{
+			Name:        "validate",
+			Description: "check the topology, its configs and templates without rendering or fetching",
+			Run:         runValidate,
+		},
+		{
+			Name:        "inspect",
+			Description: "print the topology as JSON",
+			Run:         runInspect,
+		},
+		{
+			Name:        "diff",
+			Description: "show how a render would change the deploy folder, exits with 3 if it would",
+			Flags: func(flags *flag.FlagSet) {
+				flags.BoolVar(&diffNamesOnly, "names", false, "only list the added (A), removed (D) and modified (M) files")
+			},
+			Run: runDiff,
+		},
+		{
+			Name:        "ports",
+			Description: "list the allocated ports by node, with the port each one was asked for",
+			Flags: func(flags *flag.FlagSet) {
+				flags.BoolVar(&portsJson, "json", false, "print them as JSON")
+			},
+			Run: runPorts,
+		},
+		{
+			Name:        "vendor",
+			Description: "fetch the inherited topology and service packs into the vendor folder",
+			Run:         runVendor,
+		},
+		{
+			Name:        "clean",
+			Description: "remove the deploy folder",
+			Flags: func(flags *flag.FlagSet) {
+				flags.BoolVar(&cleanVendor, "vendor", false, "remove the vendor folder as well")
+			},
+			Run: runClean,
+		},
+	}
+}
+
+func runCli(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printUsage(os.Stderr)
+		if len(args) == 0 {
+			return ExitUsage
+		}
+		return ExitOk
+	}
+	command := findCommand(args[0])
+	if command == nil {
+		fmt.Fprintf(os.Stderr, "%s: unknown command '%s'\n\n", CliName, args[0])
+		printUsage(os.Stderr)
+		return ExitUsage
+	}
+	flags := flag.NewFlagSet(fmt.Sprintf("%s %s", CliName, command.Name), flag.ContinueOnError)
+	topologyFile := flags.String("topology", topology.DefaultTopologyContext().TopologyFile, "topology definition file")
+	servicesDir := flags.String("services", "", "folder holding the service folders (default next to the topology file)")
+	deployDir := flags.String("deploy", "", "folder the rendered files end up in (default next to the topology file)")
+	vendorDir := flags.String("vendor-dir", "", "folder the inherited packs are fetched into (default next to the topology file)")
+	lockFile := flags.String("lock", "", "file render locks the allocated ports in, 'none' for no lock file (default next to the topology file)")
+	if command.Flags != nil {
+		command.Flags(flags)
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOk
+		}
+		return ExitUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s %s: unexpected arguments: %s\n", CliName, command.Name, strings.Join(flags.Args(), " "))
+		return ExitUsage
+	}
+	ctx := topology.NewTopologyContext(path.Dir(*topologyFile))
+	ctx.TopologyFile = *topologyFile
+	if *servicesDir != "" {
+		ctx.ServicesDir = *servicesDir
+	}
+	if *deployDir != "" {
+		ctx.DeployDir = *deployDir
+	}
+	if *vendorDir != "" {
+		ctx.VendorDir = *vendorDir
+	}
+	if *lockFile == NoLockFile {
+		ctx.LockFile = ""
+	} else if *lockFile != "" {
+		ctx.LockFile = *lockFile
+	}
+	if err := command.Run(ctx); err != nil {
+		if err == errChanged {
+			return ExitChanged
+		}
+		printError(command.Name, err)
+		return ExitError
+	}
+	return ExitOk
+}
+
+func findCommand(name string) *Command {
+	for _, command := range commands() {
+		if command.Name == name {
+			return &command
+		}
+	}
+	return nil
+}
+
+// Parse errors get one line each, file:line:column first, so editors can jump to them
+func printError(commandName string, err error) {
+	var parseErrs topology.ParseErrors
+	if errors.As(err, &parseErrs) {
+		for _, parseErr := range parseErrs {
+			fmt.Fprintln(os.Stderr, parseErr)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s %s: %v\n", CliName, commandName, err)
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: %s <command> [flags]\n\nCommands:\n", CliName)
+	for _, command := range commands() {
+		fmt.Fprintf(out, "  %-10s %s\n", command.Name, command.Description)
+	}
+	fmt.Fprintf(out, "\nRun '%s <command> -h' for the command flags\n", CliName)
+}
+
+func runRender(ctx topology.TopologyContext) error {
+	lazyTopology, err := topology.Load(ctx)
+	if err != nil {
+		return err
+	}
+	err = topology.Render(ctx, *lazyTopology)
+	if err != nil {
+		return err
+	}
+	return topology.WriteLock(ctx, *lazyTopology)
+}
+
+func runValidate(ctx topology.TopologyContext) error {
+	err := topology.Validate(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid\n", ctx.TopologyFile)
+	return nil
+}
+
+func runInspect(ctx topology.TopologyContext) error {
+	lazyTopology, err := topology.Load(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Print(lazyTopology.JSON())
+	return nil
+}
+
+func runDiff(ctx topology.TopologyContext) error {
+	lazyTopology, err := topology.Load(ctx)
+	if err != nil {
+		return err
+	}
+	changes, err := topology.DryRun(ctx, *lazyTopology)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if diffNamesOnly {
+			fmt.Printf("%s %s\n", change.Status, change.Path)
+		} else {
+			fmt.Print(change.Diff)
+		}
+	}
+	if len(changes) > 0 {
+		return errChanged
+	}
+	return nil
+}
+
+func runPorts(ctx topology.TopologyContext) error {
+	lazyTopology, err := topology.Load(ctx)
+	if err != nil {
+		return err
+	}
+	allocations := lazyTopology.PortAllocations()
+	if portsJson {
+		res, err := json.MarshalIndent(allocations, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(res))
+		return nil
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "NODE\tPORT\tSERVICE\tINSTANCE\tBASE PORT\tSHIFTED")
+	for _, allocation := range allocations {
+		shifted := "no"
+		if allocation.Shifted {
+			shifted = "yes"
+		}
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\t%d\t%s\n", allocation.Node, allocation.Port, allocation.Service,
+			allocation.Instance, allocation.BasePort, shifted)
+	}
+	return table.Flush()
+}
+
+func runVendor(ctx topology.TopologyContext) error {
+	return topology.Vendor(ctx)
+}
+
+func runClean(ctx topology.TopologyContext) error {
+	err := os.RemoveAll(ctx.DeployDir)
+	if err != nil {
+		return err
+	}
+	if cleanVendor {
+		return os.RemoveAll(ctx.VendorDir)
+	}
+	return nil
+}
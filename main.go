@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+func main() {
+	os.Exit(runCli(os.Args[1:]))
+}
@@ -0,0 +1,65 @@
+package topology
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const AnsibleDeployFolder = "ansible"
+const AnsibleInventoryFile = "inventory.yml"
+const AnsibleInstancesVarSuffix = "_instances" // zookeeper hosts get their zookeeper instances as zookeeper_instances
+
+var ansibleVarNameMatcher = regexp.MustCompile(`\W`)
+
+// The ansible inventory: every node under all, reached at its ip when it has one, and a group per service with the nodes its instances run on.
+// Group hosts carry the instances they run, with their name, index and ports, so playbooks don't need to look them up
+type ansibleTarget struct {
+	BaseTarget
+}
+
+func (target *ansibleTarget) Finalize(ctx TopologyContext, topology Topology) error {
+	return ctx.appendToFile(ctx.ansibleInventoryFilePath(), ansibleInventory(topology))
+}
+
+func ansibleInventory(topology Topology) string {
+	res := strings.Builder{}
+	res.WriteString("all:\n  hosts:\n")
+	for _, node := range topology.metadata.Nodes {
+		res.WriteString(fmt.Sprintf("    %s:\n", node.Name))
+		if node.IP != "" {
+			res.WriteString(fmt.Sprintf("      ansible_host: %s\n", node.IP))
+		}
+	}
+	if len(topology.services) == 0 {
+		return res.String()
+	}
+	res.WriteString("  children:\n")
+	for _, serviceDef := range topology.services {
+		res.WriteString(fmt.Sprintf("    %s:\n      hosts:\n", serviceDef.Name))
+		varName := ansibleVarNameMatcher.ReplaceAllString(serviceDef.Name, "_") + AnsibleInstancesVarSuffix
+		// Hosts in node order, those running more than one instance show up once
+		for _, nodeName := range topology.metadata.NodeNames {
+			var instances []InstanceDef
+			for _, instanceDef := range serviceDef.Instances {
+				if instanceDef.Node == nodeName {
+					instances = append(instances, instanceDef)
+				}
+			}
+			if len(instances) == 0 {
+				continue
+			}
+			res.WriteString(fmt.Sprintf("        %s:\n          %s:\n", nodeName, varName))
+			for _, instanceDef := range instances {
+				ports := make([]string, len(instanceDef.Ports))
+				for idx, port := range instanceDef.Ports {
+					ports[idx] = fmt.Sprintf("%d", port)
+				}
+				res.WriteString(fmt.Sprintf("            - name: %s\n", instanceDef.Name))
+				res.WriteString(fmt.Sprintf("              index: %d\n", instanceDef.Index))
+				res.WriteString(fmt.Sprintf("              ports: [%s]\n", strings.Join(ports, ", ")))
+			}
+		}
+	}
+	return res.String()
+}
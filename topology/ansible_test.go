@@ -0,0 +1,38 @@
+package topology
+
+import "testing"
+
+func TestAnsibleInventory(t *testing.T) {
+	topology, err := BuildTopologyFromString(NewTopologyContext("testdata"),
+		"node_count = 3\nzookeeper_cfg = 1,1,2:2181,2888\nkafka_cfg = 3:9092")
+	handleTestingError(err, t)
+	MustBeString(`all:
+  hosts:
+    dev-node01:
+    dev-node02:
+    dev-node03:
+  children:
+    zookeeper:
+      hosts:
+        dev-node01:
+          zookeeper_instances:
+            - name: zookeeper-01
+              index: 0
+              ports: [2181, 2888]
+            - name: zookeeper-02
+              index: 1
+              ports: [2182, 2889]
+        dev-node02:
+          zookeeper_instances:
+            - name: zookeeper-03
+              index: 2
+              ports: [2181, 2888]
+    kafka:
+      hosts:
+        dev-node03:
+          kafka_instances:
+            - name: kafka-01
+              index: 0
+              ports: [9092]
+`, ansibleInventory(*topology), "inventory", t)
+}
@@ -0,0 +1,292 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+const KeyValueSeparator = "="
+const ServiceConfigSuffix = "_cfg"
+const InstancePortSeparator = ":"
+const ValueSeparator = ","
+const DefaultNodeNamePrefix = "dev"
+const NodeNamePrefixPropertyName = "hostname_prefix"
+const NodeCountPropertyName = "node_count"
+const RootConfigName = "from"
+const SubFolderSeparator = "#"
+const BranchSeparator = "?"
+const MinPort = 1
+const MaxPort = 65535
+const NodeRangeSeparator = "-"             // 1-5 places an instance on each of the nodes 1 to 5
+const NodeRepeatSeparator = "x"            // 3x1 places three instances on node 1
+const AllNodes = "all"                     // One instance per node
+const EveryNode = "*"                      // Same as all
+const PortNameSeparator = "="              // client=2181 names port 2181 client
+const PortNamesPropertyName = "port_names" // port_names = client,peer names the service ports in service.config
+
+type SourceDef struct {
+	gitUrl string
+	branch string
+	subFolder string
+}
+
+type InstanceDef struct {
+	ID    string
+	Index int    `json:"index"`
+	Node  string `json:"node"`
+	Name  string `json:"name"`
+	Ports []int  `json:"ports"`
+}
+
+type ServiceDef struct {
+	Name      string            `json:"name"`
+	Instances []InstanceDef     `json:"instances"`
+	PortNames []string          `json:"port_names,omitempty"` // Names of the instance ports, in order
+	DependsOn []string          `json:"depends_on,omitempty"` // Services to deploy first
+	Config    map[string]string `json:"config"`
+}
+
+type Topology struct {
+	metadata        *TopologyMetadata
+	serviceMetadata []ServiceMetadata
+	services        []ServiceDef
+	ports           []PortAllocation
+	deployOrder     []string // Service names
+	data            TopologyView
+	jsonString      string
+}
+
+// Builds the topology defined in ctx.TopologyFile, git fetching inherited packs that aren't vendored yet
+func Load(ctx TopologyContext) (*Topology, error) {
+	topologyString, err := ioutil.ReadFile(ctx.TopologyFile)
+	if err != nil {
+		return nil, err
+	}
+	return BuildTopologyFromString(ctx, string(topologyString))
+}
+
+// Only fetches the inherited packs for the topology in ctx, nothing gets built or rendered
+func Vendor(ctx TopologyContext) error {
+	topologyString, err := ioutil.ReadFile(ctx.TopologyFile)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(topologyString), "\n")
+	topologyMetadata, err := TopologyMetadataFromLines(ctx, lines)
+	if err != nil {
+		return err
+	}
+	return fetchInheritedPacks(ctx, lines, *topologyMetadata)
+}
+
+func BuildTopologyFromString(ctx TopologyContext, topologyString string) (*Topology, error) {
+	return BuildTopologyFromLines(ctx, strings.Split(topologyString, "\n"))
+}
+
+func BuildTopologyFromLines(ctx TopologyContext, lines []string) (*Topology, error) {
+	res := map[string]interface{}{}
+	topologyMetadata, err := TopologyMetadataFromLines(ctx, lines)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fetchInheritedPacks(ctx, lines, *topologyMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceMetadataList, err := ServiceMetadataFromLines(ctx, lines, *topologyMetadata, true)
+	if err != nil {
+		return nil, err
+	}
+	err = placeServices(ctx, serviceMetadataList, topologyMetadata.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	order, err := deployOrder(ctx, serviceMetadataList)
+	if err != nil {
+		return nil, err
+	}
+	serviceDefs := make([]ServiceDef, len(serviceMetadataList))
+	ports, err := portAllocatorFor(topologyMetadata.Config, ctx.topologyConfigFile(), topologyMetadata.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := readLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ports.claimLocked(lock, serviceMetadataList, topologyMetadata.NodeNames)
+	var errs ParseErrors
+	for idx, serviceMetadata := range serviceMetadataList {
+		serviceDef, err := serviceDefFromMetadata(serviceMetadata, *topologyMetadata, ports)
+		if portErr, isParseError := err.(*ParseError); isParseError {
+			errs = append(errs, ParseErrors{portErr}.at(ctx.TopologyFile, serviceMetadata.Line, 0, "")...)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		res[serviceDef.Name] = *serviceDef
+		serviceDefs[idx] = *serviceDef
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	// Stacks in the order their services deploy
+	stackNames := getStackNames(topologyMetadata.Config.GetString("stack", DefaultSwarmStackName),
+		metadataInDeployOrder(serviceMetadataList, order))
+	res[NodeCountPropertyName] = topologyMetadata.NodeCount
+	res["config"] = topologyMetadata.Config.data
+	res["node_names"] = topologyMetadata.NodeNames
+	res["nodes"] = topologyMetadata.Nodes
+	res["stack_names"] = stackNames
+	res["deploy_order"] = order
+
+	jsonString, err := TopologyToJSonString(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Topology{
+		metadata:        topologyMetadata,
+		serviceMetadata: serviceMetadataList,
+		services:        serviceDefs,
+		ports:           ports.report(),
+		deployOrder:     order,
+		data:            newTopologyView(*topologyMetadata, serviceDefs, stackNames, order),
+		jsonString:      jsonString,
+	}, nil
+}
+
+// Git fetches the topology and service inheritance packs ('from = ' configs) into the vendor folder.
+// Packs that are already vendored are left untouched, offline contexts only log the missing ones
+func fetchInheritedPacks(ctx TopologyContext, lines []string, topologyMetadata TopologyMetadata) error {
+	gitCache := NewGitCache()
+	defer gitCache.cleanup()
+	var fetch = func(sourceSpec string, destFolder string) error {
+		if !ctx.Offline {
+			return gitCache.fetch(sourceSpec, destFolder)
+		}
+		if _, err := os.Stat(destFolder); os.IsNotExist(err) {
+			log.Println(fmt.Sprintf("offline, not fetching '%s' into: '%s'", sourceSpec, destFolder))
+		}
+		return nil
+	}
+	inheritTopologySpec := topologyMetadata.Config.GetString(RootConfigName, "")
+	if inheritTopologySpec != "" {
+		err := fetch(inheritTopologySpec, ctx.inheritRootDir())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Quick look ahead round just to GIT fetch inheritance / 'from = ' service configs
+	serviceMetadataListForInheritGitFetch, err := ServiceMetadataFromLines(ctx, lines, topologyMetadata, false)
+	if err != nil {
+		return err
+	}
+	for _, serviceMetadata := range serviceMetadataListForInheritGitFetch {
+		// !!!  WARNING  !!! with parse == false the only valid field in service metadata is Name
+		configFilePath := ctx.serviceConfigFilePath(serviceMetadata.Name)
+		serviceConfig, err := ReadConfigFile(configFilePath, map[string]interface{}{}, nil)
+		if _, isParseErrors := err.(ParseErrors); isParseErrors {
+			continue // reported along with all the other parse errors, once the services get parsed
+		} else if err != nil {
+			return err
+		}
+		inheritServiceSpec := serviceConfig.GetString(RootConfigName, "")
+		if inheritServiceSpec != "" {
+			err := fetch(inheritServiceSpec, ctx.inheritServiceDir(serviceMetadata.Name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TopologyToJSonString(topology map[string]interface{}) (string, error) {
+	topologyJson, err := json.MarshalIndent(topology, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(topologyJson) + "\n", nil
+}
+
+func serviceDefFromMetadata(service ServiceMetadata, topology TopologyMetadata, ports *portAllocator) (*ServiceDef, error) {
+	instanceDefs := make([]InstanceDef, len(service.NodeIDs))
+	nodeNames := topology.NodeNames
+	fixedPorts := service.Config.GetString(FixedPortsPropertyName, "false") == "true"
+	for idx, nodeID := range service.NodeIDs {
+		id := nodeId(idx)
+		name := instanceName(service.Name, idx)
+		instancePorts, err := ports.allocatePorts(service.Ports, nodeNames[nodeID-1], service.Name, name, fixedPorts)
+		if err != nil {
+			return nil, err
+		}
+		instanceDefs[idx] = InstanceDef{
+			ID:    id,
+			Index: idx,
+			Node:  nodeNames[nodeID-1],
+			Name:  name,
+			Ports: instancePorts,
+		}
+	}
+	return &ServiceDef{
+		Name:      service.Name,
+		Instances: instanceDefs,
+		PortNames: service.PortNames,
+		DependsOn: dependenciesOf(service),
+		Config:    service.RawConfig.data,
+	}, nil
+}
+
+func nodeName(nodenamePrefix string, idx int) string {
+	return fmt.Sprintf("%s-node%02d", nodenamePrefix, idx+1)
+}
+
+func instanceName(serviceName string, idx int) string {
+	return fmt.Sprintf("%s-%s", serviceName, nodeId(idx))
+}
+
+func nodeId(idx int) string {
+	return fmt.Sprintf("%02d", idx+1)
+}
+
+func getStackNames(defaultStack string, serviceDefs []ServiceMetadata) []string {
+	cache := map[string]interface{}{}
+	var names []string
+	for _, serviceDef := range serviceDefs {
+		stackName := serviceDef.Config.GetString("stack", defaultStack)
+		if cache[stackName] == nil {
+			names = append(names, stackName)
+			cache[stackName] = ""
+		}
+	}
+	return names
+}
+
+func parseSourceDef(urlSpec string) *SourceDef {
+	var subFolder = ""
+	tmp := strings.Split(urlSpec, SubFolderSeparator)
+	if len(tmp) > 1 {
+		subFolder = tmp[1]
+		urlSpec = tmp[0]
+	}
+	var branch = "master"
+	tmp1 := strings.Split(urlSpec, BranchSeparator)
+	if len(tmp1) > 1 {
+		branch = tmp1[1]
+		urlSpec = tmp1[0]
+	}
+	return &SourceDef{
+		gitUrl:    urlSpec,
+		branch:    branch,
+		subFolder: subFolder,
+	}
+}
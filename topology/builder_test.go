@@ -0,0 +1,88 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuildTopology(t *testing.T) {
+	topology, err := Load(NewTopologyContext("testdata"))
+	if err != nil {
+		t.Errorf("Unable to read topology, err: %s", err)
+	}
+	content := topology.data
+	mustContainKey("node_count", content, t)
+	//mustContainKey("node_names", content, t)
+	//mustContainKey("service_names", content, t)
+	mustContainKey("zookeeper", content, t)
+
+	zookeeperService, _ := content["zookeeper"].(ServiceView)
+	//mustContainKey("name", zookeeperService, t)
+	mustContainKey("instances", zookeeperService, t)
+	zookeeper1stInstance := instance(zookeeperService, 0)
+	MustBeInt(2181, port(zookeeper1stInstance, 0), "first instance first port", t)
+	zookeeper2ndInstance := instance(zookeeperService, 1)
+	MustBeInt(2182, port(zookeeper2ndInstance, 0), "second instance first port", t)
+}
+
+func mustContainKey(key string, content map[string]interface{}, t *testing.T) {
+	if content[key] == nil {
+		nodeJson, _ := json.Marshal(content)
+		t.Errorf("Should have key '%s',\njson: %s", key, string(nodeJson))
+	}
+}
+
+func instance(content map[string]interface{}, index int) InstanceView {
+	return content["instances"].([]InstanceView)[index]
+}
+
+func port(instance InstanceView, index int) int {
+	return instance.ports()[index]
+}
+
+func TestTopologyServices(t *testing.T) {
+	topology, err := Load(NewTopologyContext("testdata"))
+	handleTestingError(err, t)
+	MustBeInt(1, len(topology.Services()), "service count", t)
+	MustBeInt(2, len(topology.NodeNames()), "node name count", t)
+	zookeeper, exists := topology.Service("zookeeper")
+	if !exists {
+		t.Fatalf("zookeeper service should exist")
+	}
+	MustBeInt(3, len(zookeeper.Instances), "zookeeper instance count", t)
+	MustBeString("dev-node01", zookeeper.Instances[1].Node, "second instance node", t)
+	MustBeInt(2182, zookeeper.Instances[1].Ports[0], "second instance first port", t)
+	MustBeString("kafka", zookeeper.Config["stack"], "zookeeper stack config", t)
+	if _, exists := topology.Service("kafka"); exists {
+		t.Errorf("kafka service should not exist")
+	}
+}
+
+func TestPortNamesFromServiceConfig(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"services/zookeeper/service.config": "port_names = client, peer"}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 1\nzookeeper_cfg = 1:2181,2888", t)
+	zookeeper, _ := topology.Service("zookeeper")
+	MustBeString("[client peer]", fmt.Sprint(zookeeper.PortNames), "port names", t)
+
+	_, err := BuildTopologyFromString(ctx, "node_count = 1\nzookeeper_cfg = 1:2181")
+	MustBeString(fmt.Sprintf("%s:2: port_names in its service config has 2 names for 1 ports: 'zookeeper_cfg = 1:2181' "+
+		"(name every port, in order)", ctx.TopologyFile), fmt.Sprint(err), "error", t)
+}
+
+func TestReservedServiceNames(t *testing.T) {
+	ctx := NewTopologyContext("testdata")
+	_, err := BuildTopologyFromString(ctx, "node_count = 2\nconfig_cfg = 1,2:9100")
+	MustBeString(fmt.Sprintf("%s:2: service name 'config' is reserved: 'config_cfg = 1,2:9100' (rename the service, "+
+		"these are taken: %s)", ctx.TopologyFile, strings.Join(ReservedServiceNames, ", ")), fmt.Sprint(err), "error", t)
+
+	topology, err := BuildTopologyFromString(ctx, "node_count = 1\nkafka_cfg = 1:9092")
+	handleTestingError(err, t)
+	delete(topology.data, "kafka")
+	if _, err := topology.data.withServices(topology.services); err == nil {
+		t.Errorf("services missing from the view should fail")
+	}
+}
@@ -0,0 +1,198 @@
+package topology
+
+import (
+	"fmt"
+	"strings"
+)
+
+const ComposeDeployFolder = "compose"
+const ComposeFile = "docker-compose.yml"
+const ComposeHostPropertyName = "compose_host" // What instances get as node name in the compose file
+const DefaultComposeHost = "host.docker.internal"
+
+// Every swarm-service fragment in a single docker-compose.yml, for running the whole topology on one machine.
+// Instances all get the compose host as node and keep their ports, but for the ones clashing on it. Those ports get
+// published as is, swarm deploy keys get dropped
+type composeTarget struct {
+	BaseTarget
+	host    string
+	view    TopologyView // Single host version of the topology
+	content string
+}
+
+func (target *composeTarget) Prepare(ctx TopologyContext, topology Topology) error {
+	target.host = topology.metadata.Config.GetString(ComposeHostPropertyName, DefaultComposeHost)
+	metadata := *topology.metadata
+	metadata.NodeCount = 1
+	metadata.NodeNames = []string{target.host}
+	metadata.Nodes = []NodeDef{{ID: 1, Name: target.host, Labels: map[string]string{}, Attributes: map[string]string{}}}
+	serviceDefs, err := singleHostServices(topology, target.host)
+	if err != nil {
+		return err
+	}
+	target.view = newTopologyView(metadata, serviceDefs, topology.data["stack_names"].([]string), topology.deployOrder)
+	return nil
+}
+
+func (target *composeTarget) Service(ctx TopologyContext, topology Topology, service ServiceDef) error {
+	dependencies := topology.dependencyInstances(service, "")
+	var addComposeKeys = func(fragment string, instance InstanceView) string {
+		return withDependsOn(withComposeKeys(fragment, instance, target.host), dependencies)
+	}
+	servicesString, err := renderSwarmServiceFragments(ctx, service.Name, target.view, addComposeKeys)
+	if err != nil {
+		return err
+	}
+	target.content += withoutServiceKey(servicesString, "deploy")
+	return nil
+}
+
+func (target *composeTarget) ClaimsTemplate(relPath string) bool {
+	return isSwarmServiceFragment(relPath)
+}
+
+func (target *composeTarget) Finalize(ctx TopologyContext, topology Topology) error {
+	if target.content == "" {
+		return nil
+	}
+	composeString, err := RenderTemplateString(composeWrapper, map[string]interface{}{
+		"content": target.content,
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.appendToFile(ctx.composeFilePath(), composeString)
+}
+
+// Topology services with every instance on host. Instances keep the ports they got, locked ones included, unless
+// an instance from another node already has it on host: then it moves to the next free one, or the build fails for
+// fixed_ports services
+func singleHostServices(topology Topology, host string) ([]ServiceDef, error) {
+	ports, err := portAllocatorFor(topology.metadata.Config, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ServiceDef, len(topology.services))
+	for idx, serviceDef := range topology.services {
+		fixedPorts := topology.serviceMetadataOf(serviceDef).Config.GetString(FixedPortsPropertyName, "false") == "true"
+		instanceDefs := make([]InstanceDef, len(serviceDef.Instances))
+		for instanceIdx, instanceDef := range serviceDef.Instances {
+			instancePorts, err := ports.allocatePorts(instanceDef.Ports, host, serviceDef.Name, instanceDef.Name, fixedPorts)
+			if err != nil {
+				return nil, err
+			}
+			instanceDef.Node = host
+			instanceDef.Ports = instancePorts
+			instanceDefs[instanceIdx] = instanceDef
+		}
+		serviceDef.Instances = instanceDefs
+		res[idx] = serviceDef
+	}
+	return res, nil
+}
+
+// Adds the instance ports and, for the default compose host, its host-gateway mapping right under the compose
+// service the fragment defines. Fragments are expected to define one service, keys they already have are left alone
+func withComposeKeys(fragment string, instance InstanceView, host string) string {
+	lines := strings.Split(fragment, "\n")
+	keyIdx, childIndent := serviceKeyOf(lines)
+	if keyIdx < 0 {
+		return fragment
+	}
+
+	var added []string
+	if ports := instance.ports(); len(ports) > 0 && !hasComposeKey(lines, childIndent, "ports") {
+		added = append(added, childIndent+"ports:")
+		for _, port := range ports {
+			added = append(added, fmt.Sprintf(`%s  - "%d:%d"`, childIndent, port, port))
+		}
+	}
+	if host == DefaultComposeHost && !hasComposeKey(lines, childIndent, "extra_hosts") {
+		added = append(added, childIndent+"extra_hosts:", fmt.Sprintf(`%s  - "%s:host-gateway"`, childIndent, host))
+	}
+	res := append(append(append([]string{}, lines[:keyIdx+1]...), added...), lines[keyIdx+1:]...)
+	return strings.Join(res, "\n")
+}
+
+// Line index of the service key a fragment starts with, -1 if it's empty, and the indent of its keys
+func serviceKeyOf(lines []string) (int, string) {
+	keyIdx := -1
+	childIndent := ""
+	for idx, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+		if keyIdx < 0 {
+			keyIdx = idx
+			childIndent = indent + "  "
+			continue
+		}
+		childIndent = indent
+		break
+	}
+	return keyIdx, childIndent
+}
+
+// A fragment moved under the services key of a stack: whatever indent it was written with, its service keys end up
+// indented by two spaces, and it ends with a single newline so the next fragment starts on its own line
+func underServices(fragment string) string {
+	lines := strings.Split(strings.TrimRight(fragment, " \n"), "\n")
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if lineIndent := len(line) - len(strings.TrimLeft(line, " ")); indent < 0 || lineIndent < indent {
+			indent = lineIndent
+		}
+	}
+	if indent < 0 {
+		return ""
+	}
+	for idx, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[idx] = ""
+			continue
+		}
+		lines[idx] = "  " + line[indent:]
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Fragments under services without key and what's nested under it, in every service they define. Compose has no
+// use for the swarm deploy key, placement constraints included
+func withoutServiceKey(fragments string, key string) string {
+	var res []string
+	dropping := false
+	for _, line := range strings.Split(fragments, "\n") {
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if strings.TrimSpace(line) == "" {
+			res = append(res, line)
+			continue
+		}
+		if dropping && indent > 4 {
+			continue
+		}
+		dropping = indent == 4 && strings.HasPrefix(line[indent:], key+":")
+		if !dropping {
+			res = append(res, line)
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+func hasComposeKey(lines []string, indent string, key string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, indent+key+":") {
+			return true
+		}
+	}
+	return false
+}
+
+const composeWrapper = `# Single host version of the topology, the swarm stacks are the cluster one
+version: "3.7"
+
+services:
+{{ .content }}`
@@ -0,0 +1,92 @@
+package topology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRenderComposeFile(t *testing.T) {
+	deployDir, err := ioutil.TempDir("", "lazy_test")
+	handleTestingError(err, t)
+	defer os.RemoveAll(deployDir)
+	ctx := NewTopologyContext("testdata")
+	ctx.DeployDir = deployDir
+
+	topology, err := Load(ctx)
+	handleTestingError(err, t)
+	err = Render(ctx, *topology)
+	handleTestingError(err, t)
+
+	composeFile, err := readTextFile(path.Join(deployDir, "compose/docker-compose.yml"))
+	handleTestingError(err, t)
+	MustBeString(`# Single host version of the topology, the swarm stacks are the cluster one
+version: "3.7"
+
+services:
+  zookeeper-01:
+    ports:
+      - "2181:2181"
+      - "2888:2888"
+      - "3888:3888"
+    extra_hosts:
+      - "host.docker.internal:host-gateway"
+    image: zookeeper
+    environment:
+      ZOO_TICK_TIME: 2000
+      ZOO_SERVERS: host.docker.internal:2888:3888 host.docker.internal:2889:3889 host.docker.internal:2890:3890
+  zookeeper-02:
+    ports:
+      - "2182:2182"
+      - "2889:2889"
+      - "3889:3889"
+    extra_hosts:
+      - "host.docker.internal:host-gateway"
+    image: zookeeper
+    environment:
+      ZOO_TICK_TIME: 2000
+      ZOO_SERVERS: host.docker.internal:2888:3888 host.docker.internal:2889:3889 host.docker.internal:2890:3890
+  zookeeper-03:
+    ports:
+      - "2183:2183"
+      - "2890:2890"
+      - "3890:3890"
+    extra_hosts:
+      - "host.docker.internal:host-gateway"
+    image: zookeeper
+    environment:
+      ZOO_TICK_TIME: 2000
+      ZOO_SERVERS: host.docker.internal:2888:3888 host.docker.internal:2889:3889 host.docker.internal:2890:3890
+`, composeFile, "docker-compose.yml", t)
+}
+
+func TestWithComposeKeysKeepsExistingKeys(t *testing.T) {
+	instance := newInstanceView(InstanceDef{Ports: []int{8080}}, nil, NodeDef{})
+	fragment := "  app:\n    image: app\n    ports:\n      - \"80:8080\"\n"
+	MustBeString(fragment, withComposeKeys(fragment, instance, "localhost"), "fragment", t)
+}
+
+func TestComposeKeepsInstancePorts(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"topology.config": "node.1.reserved_ports = 8080"}, t)
+	defer cleanup()
+
+	// app-01 keeps the port it got shifted to on its node, db-01 gets shifted again on the single host
+	topology := buildTopology(ctx, "node_count = 2\napp_cfg = 1,2:8080\ndb_cfg = 2:8081", t)
+	services, err := singleHostServices(*topology, DefaultComposeHost)
+	handleTestingError(err, t)
+	MustBeString("[8081] [8080]", fmt.Sprint(services[0].Instances[0].Ports, " ", services[0].Instances[1].Ports),
+		"app ports", t)
+	MustBeString("[8082]", fmt.Sprint(services[1].Instances[0].Ports), "db ports", t)
+}
+
+func TestComposeFixedPortsConflict(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"services/app/service.config": "fixed_ports = true"}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 2\napp_cfg = 1,2:8080", t)
+	_, err := singleHostServices(*topology, DefaultComposeHost)
+	MustBeString("port 8080 of 'app-02' is fixed but app-01 already has it on host.docker.internal "+
+		"(move one of them or drop fixed_ports from its service config)", fmt.Sprint(err), "error", t)
+}
@@ -0,0 +1,134 @@
+package topology
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DependsOnPropertyName = "depends_on" // depends_on = zookeeper,kafka in service.config deploys the service after those
+const DeployOrderFile = "deploy-order.txt" // Services in deploy order, one per line
+
+// Service names in deploy order: every service right after the ones it depends on, in topology order otherwise
+func deployOrder(ctx TopologyContext, services []ServiceMetadata) ([]string, error) {
+	byName := map[string]ServiceMetadata{}
+	for _, service := range services {
+		byName[service.Name] = service
+	}
+	var errs ParseErrors
+	for _, service := range services {
+		for _, dependency := range dependenciesOf(service) {
+			if _, exists := byName[dependency]; !exists {
+				errs = append(errs, ParseErrors{{
+					Message: fmt.Sprintf("%s: service '%s' isn't in the topology", DependsOnPropertyName, dependency),
+					Hint:    fmt.Sprintf("add it or drop it from the %s of '%s'", DependsOnPropertyName, service.Name),
+				}}.at(ctx.TopologyFile, service.Line, 0, "")...)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	const visiting, visited = 1, 2
+	state := map[string]int{}
+	var res []string
+	var path []string // Services being visited, each one depending on the next
+	var visit func(name string) *ParseError
+	visit = func(name string) *ParseError {
+		if state[name] == visited {
+			return nil
+		}
+		if state[name] == visiting {
+			var cycle []string
+			for idx := range path {
+				if path[idx] == name {
+					cycle = append(append(cycle, path[idx:]...), name)
+					break
+				}
+			}
+			return ParseErrors{{
+				Message: fmt.Sprintf("%s cycle: %s", DependsOnPropertyName, strings.Join(cycle, " -> ")),
+				Hint:    fmt.Sprintf("drop one of them from the %s of the other", DependsOnPropertyName),
+			}}.at(ctx.TopologyFile, byName[name].Line, 0, "")[0]
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dependency := range dependenciesOf(byName[name]) {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		res = append(res, name)
+		return nil
+	}
+	for _, service := range services {
+		if err := visit(service.Name); err != nil {
+			return nil, ParseErrors{err}
+		}
+	}
+	return res, nil
+}
+
+func dependenciesOf(service ServiceMetadata) []string {
+	var res []string
+	for _, token := range splitTokens(service.Config.GetString(DependsOnPropertyName, ""), ValueSeparator, 1) {
+		if token.text != "" {
+			res = append(res, token.text)
+		}
+	}
+	return res
+}
+
+// services sorted by order, a list of their names
+func metadataInDeployOrder(services []ServiceMetadata, order []string) []ServiceMetadata {
+	byName := map[string]ServiceMetadata{}
+	for _, service := range services {
+		byName[service.Name] = service
+	}
+	res := make([]ServiceMetadata, len(order))
+	for idx, name := range order {
+		res[idx] = byName[name]
+	}
+	return res
+}
+
+// Services in deploy order
+func (topology Topology) servicesInDeployOrder() []ServiceDef {
+	res := make([]ServiceDef, len(topology.deployOrder))
+	for idx, name := range topology.deployOrder {
+		res[idx], _ = topology.Service(name)
+	}
+	return res
+}
+
+// Instance names of the services serviceDef depends on, only the ones in stack unless it's empty
+func (topology Topology) dependencyInstances(serviceDef ServiceDef, stack string) []string {
+	var res []string
+	for _, dependency := range serviceDef.DependsOn {
+		dependencyDef, _ := topology.Service(dependency)
+		if stack != "" && topology.stackOf(dependencyDef) != stack {
+			continue
+		}
+		for _, instanceDef := range dependencyDef.Instances {
+			res = append(res, instanceDef.Name)
+		}
+	}
+	return res
+}
+
+// Adds a depends_on key with the dependency instances under the service the fragment defines, unless it has one
+func withDependsOn(fragment string, dependencies []string) string {
+	lines := strings.Split(fragment, "\n")
+	keyIdx, childIndent := serviceKeyOf(lines)
+	if keyIdx < 0 || len(dependencies) == 0 || hasComposeKey(lines, childIndent, DependsOnPropertyName) {
+		return fragment
+	}
+	added := []string{childIndent + DependsOnPropertyName + ":"}
+	for _, dependency := range dependencies {
+		added = append(added, fmt.Sprintf("%s  - %s", childIndent, dependency))
+	}
+	res := append(append(append([]string{}, lines[:keyIdx+1]...), added...), lines[keyIdx+1:]...)
+	return strings.Join(res, "\n")
+}
@@ -0,0 +1,54 @@
+package topology
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDeployOrder(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{
+		"services/connect/service.config": "depends_on = kafka\nstack = connect",
+		"services/kafka/service.config":   "depends_on = zookeeper\nstack = kafka",
+	}, t)
+	defer cleanup()
+	ctx.LockFile = ""
+
+	topology := buildTopology(ctx,
+		"node_count = 2\nconnect_cfg = 2:8083\nkafka_cfg = 1,2:9092\nzookeeper_cfg = 1:2181\nschema_cfg = 1:8081", t)
+	MustBeString("[zookeeper kafka connect schema]", fmt.Sprint(topology.deployOrder), "deploy order", t)
+	MustBeString("[app kafka connect]", fmt.Sprint(topology.data["stack_names"]), "stacks in deploy order", t)
+	connect, _ := topology.Service("connect")
+	MustBeString("[kafka-01 kafka-02]", fmt.Sprint(topology.dependencyInstances(connect, "")), "connect dependencies", t)
+	MustBeString("[]", fmt.Sprint(topology.dependencyInstances(connect, "connect")), "connect stack dependencies", t)
+
+	handleTestingError(Render(ctx, *topology), t)
+	content, err := readTextFile(ctx.deployOrderFilePath())
+	handleTestingError(err, t)
+	MustBeString("zookeeper\nkafka\nconnect\nschema\n", content, "deploy order file", t)
+
+	handleTestingError(ctx.appendToFile(ctx.serviceConfigFilePath("zookeeper"), "depends_on = connect"), t)
+	_, err = BuildTopologyFromString(ctx, "node_count = 1\nconnect_cfg = 1:8083\nkafka_cfg = 1:9092\nzookeeper_cfg = 1:2181")
+	MustBeString(fmt.Sprintf("%s:2: depends_on cycle: connect -> kafka -> zookeeper -> connect "+
+		"(drop one of them from the depends_on of the other)", ctx.TopologyFile), fmt.Sprint(err), "cycle", t)
+
+	_, err = BuildTopologyFromString(ctx, "node_count = 1\nconnect_cfg = 1:8083")
+	MustBeString(fmt.Sprintf("%s:2: depends_on: service 'kafka' isn't in the topology "+
+		"(add it or drop it from the depends_on of 'connect')", ctx.TopologyFile), fmt.Sprint(err), "unknown dependency", t)
+}
+
+func TestDeployOrderIsntAServiceName(t *testing.T) {
+	_, err := BuildTopologyFromString(NewTopologyContext("testdata"), "node_count = 1\ndeploy_order_cfg = 1:9100")
+	if err == nil || !strings.Contains(err.Error(), "service name 'deploy_order' is reserved") {
+		t.Errorf("a deploy_order service should fail the build, got: %v", err)
+	}
+}
+
+func TestWithDependsOn(t *testing.T) {
+	fragment := "  kafka-01:\n    image: kafka\n"
+	MustBeString("  kafka-01:\n    depends_on:\n      - zookeeper-01\n      - zookeeper-02\n    image: kafka\n",
+		withDependsOn(fragment, []string{"zookeeper-01", "zookeeper-02"}), "depends_on", t)
+	MustBeString(fragment, withDependsOn(fragment, nil), "no dependencies", t)
+	existing := "  kafka-01:\n    depends_on: [zookeeper]\n"
+	MustBeString(existing, withDependsOn(existing, []string{"zookeeper-01"}), "existing depends_on", t)
+}
@@ -0,0 +1,302 @@
+package topology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const DiffContextLines = 3 // Unchanged lines around every change, same as diff -u
+
+type ChangeStatus string
+
+const (
+	Added    ChangeStatus = "A"
+	Removed  ChangeStatus = "D"
+	Modified ChangeStatus = "M"
+)
+
+// What a render would do to one file in the deploy folder
+type FileChange struct {
+	Path   string       // Relative to the deploy folder
+	Status ChangeStatus // Added, Removed or Modified
+	Diff   string       // Unified diff, current deploy file first
+}
+
+// Renders the topology into a temp folder and compares it with the current deploy folder, which is left alone.
+// Changes are sorted by path, none means a render wouldn't change anything
+func DryRun(ctx TopologyContext, topology Topology) ([]FileChange, error) {
+	tempDir, err := ioutil.TempDir("", "lazy_deploy")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempCtx := ctx
+	tempCtx.DeployDir = tempDir
+	tempCtx.dirCache = NewDirCache()
+	err = renderAll(tempCtx, topology)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := readTree(ctx.DeployDir)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := readTree(tempDir)
+	if err != nil {
+		return nil, err
+	}
+	return diffTrees(current, rendered), nil
+}
+
+// A file of a deploy folder
+type treeFile struct {
+	content string
+	mode    os.FileMode
+}
+
+// Relative file path -> file content and mode, for every file under rootPath. Missing rootPath is an empty tree
+func readTree(rootPath string) (map[string]treeFile, error) {
+	res := map[string]treeFile{}
+	err := filepath.Walk(rootPath, func(filePath string, handle os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if handle.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(rootPath, filePath)
+		if err != nil {
+			return err
+		}
+		content, err := readTextFile(filePath)
+		if err != nil {
+			return err
+		}
+		res[filepath.ToSlash(relPath)] = treeFile{content: content, mode: handle.Mode().Perm()}
+		return nil
+	})
+	return res, err
+}
+
+func diffTrees(before map[string]treeFile, after map[string]treeFile) []FileChange {
+	var res []FileChange
+	for filePath, file := range after {
+		previous, exists := before[filePath]
+		if !exists {
+			res = append(res, FileChange{
+				Path:   filePath,
+				Status: Added,
+				Diff:   unifiedDiff("/dev/null", "b/"+filePath, "", file.content),
+			})
+		} else if previous != file {
+			// Mode changes come first, the way git diff shows them
+			var modeDiff string
+			if previous.mode != file.mode {
+				modeDiff = fmt.Sprintf("old mode %s\nnew mode %s\n", gitMode(previous.mode), gitMode(file.mode))
+			}
+			res = append(res, FileChange{
+				Path:   filePath,
+				Status: Modified,
+				Diff:   modeDiff + unifiedDiff("a/"+filePath, "b/"+filePath, previous.content, file.content),
+			})
+		}
+	}
+	for filePath, file := range before {
+		if _, exists := after[filePath]; !exists {
+			res = append(res, FileChange{
+				Path:   filePath,
+				Status: Removed,
+				Diff:   unifiedDiff("a/"+filePath, "/dev/null", file.content, ""),
+			})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res
+}
+
+// 0755 -> 100755
+func gitMode(mode os.FileMode) string {
+	return fmt.Sprintf("100%o", mode.Perm())
+}
+
+// One line of the edit script: ' ' keep, '-' remove, '+' add. aPos and bPos are where it happens in a and b
+type diffOp struct {
+	kind byte
+	line string
+	aPos int
+	bPos int
+}
+
+// diff -u style diff of two texts, empty when they're the same
+func unifiedDiff(fromName string, toName string, a string, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	// Hunks are op index ranges, changes closer than twice the context end up in the same hunk
+	var hunks [][2]int
+	for idx, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		start := idx - DiffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := idx + DiffContextLines + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1][1] {
+			hunks[len(hunks)-1][1] = end
+		} else {
+			hunks = append(hunks, [2]int{start, end})
+		}
+	}
+
+	res := strings.Builder{}
+	res.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName))
+	for _, hunk := range hunks {
+		aCount, bCount := 0, 0
+		body := strings.Builder{}
+		for _, op := range ops[hunk[0]:hunk[1]] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+			body.WriteByte(op.kind)
+			body.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		res.WriteString(fmt.Sprintf("@@ -%s +%s @@\n",
+			hunkRange(ops[hunk[0]].aPos, aCount), hunkRange(ops[hunk[0]].bPos, bCount)))
+		res.WriteString(body.String())
+	}
+	return res.String()
+}
+
+// Same as diff -u: empty ranges point at the line before, single line ranges have no count
+func hunkRange(pos int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", pos)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", pos+1)
+	}
+	return fmt.Sprintf("%d,%d", pos+1, count)
+}
+
+// Lines keep their line ending, so a missing one at the end of the text shows up in the diff
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Edit script out of a shortest one of a and b, once their common prefix and suffix are out of the way.
+// Rendered files mostly change here and there, which keeps Myers' algorithm close to linear
+func diffLines(a []string, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var ops []diffOp
+	for idx := 0; idx < prefix; idx++ {
+		ops = append(ops, diffOp{kind: ' ', line: a[idx], aPos: idx, bPos: idx})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix)...)
+	for idx := suffix; idx > 0; idx-- {
+		ops = append(ops, diffOp{kind: ' ', line: a[len(a)-idx], aPos: len(a) - idx, bPos: len(b) - idx})
+	}
+	return ops
+}
+
+// Myers' O((n+m)d) diff, positions are offset by offset. Only the diagonals reached at each step are kept
+// for backtracking, so memory is O(d^2) rather than O(n*m)
+func myersDiff(a []string, b []string, offset int) []diffOp {
+	n, m := len(a), len(b)
+	v := make([]int, 2*(n+m)+3) // Diagonal k -> furthest x reached on it, at index k+n+m+1
+	center := n + m + 1
+	var trace [][]int // Step d -> v for diagonals -d to d, at index k+d
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[center+k-1] < v[center+k+1] {
+				x = v[center+k+1] // Down, b[y] gets added
+			} else {
+				x = v[center+k-1] + 1 // Right, a[x] gets removed
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[center+k] = x
+			if x >= n && y >= m {
+				found = true
+			}
+		}
+		trace = append(trace, append([]int{}, v[center-d:center+d+1]...))
+	}
+
+	var reversed []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		previous := trace[d-1]
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && previous[k-1+d-1] < previous[k+1+d-1] {
+			prevK = k + 1
+		}
+		prevX := previous[prevK+d-1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffOp{kind: ' ', line: a[x], aPos: offset + x, bPos: offset + y})
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, diffOp{kind: '+', line: b[y], aPos: offset + x, bPos: offset + y})
+		} else {
+			x--
+			reversed = append(reversed, diffOp{kind: '-', line: a[x], aPos: offset + x, bPos: offset + y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, diffOp{kind: ' ', line: a[x], aPos: offset + x, bPos: offset + y})
+	}
+	ops := make([]diffOp, len(reversed))
+	for idx, op := range reversed {
+		ops[len(reversed)-1-idx] = op
+	}
+	return ops
+}
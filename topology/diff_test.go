@@ -0,0 +1,117 @@
+package topology
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nk\nl"
+	MustBeString(`--- a/x
++++ b/x
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -7,5 +7,5 @@
+ g
+ h
+ i
+-j
+ k
++l
+\ No newline at end of file
+`, unifiedDiff("a/x", "b/x", before, after), "unified diff", t)
+	MustBeString("", unifiedDiff("a/x", "b/x", before, before), "no diff", t)
+	MustBeString("--- /dev/null\n+++ b/x\n@@ -0,0 +1 @@\n+a\n", unifiedDiff("/dev/null", "b/x", "", "a\n"), "added", t)
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := NewTopologyContext("testdata")
+	ctx.DeployDir = "testdata/no_deploy_yet"
+	topology, err := Load(ctx)
+	handleTestingError(err, t)
+	changes, err := DryRun(ctx, *topology)
+	handleTestingError(err, t)
+	MustBeInt(10, len(changes), "change count", t)
+	for _, change := range changes {
+		MustBeString(string(Added), string(change.Status), change.Path, t)
+	}
+	if exists(ctx.DeployDir) {
+		t.Errorf("dry run should not touch the deploy folder")
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	var randomLines = func() []string {
+		lines := make([]string, random.Intn(12))
+		for idx := range lines {
+			lines[idx] = fmt.Sprintf("%c\n", 'a'+random.Intn(4))
+		}
+		return lines
+	}
+	for round := 0; round < 500; round++ {
+		a, b := randomLines(), randomLines()
+		var fromA, fromB []string
+		edits := 0
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				fromA = append(fromA, op.line)
+			}
+			if op.kind != '-' {
+				fromB = append(fromB, op.line)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+		MustBeString(strings.Join(a, ""), strings.Join(fromA, ""), "a out of the edit script", t)
+		MustBeString(strings.Join(b, ""), strings.Join(fromB, ""), "b out of the edit script", t)
+		MustBeInt(len(a)+len(b)-2*lcsLength(a, b), edits, fmt.Sprintf("edits of %q -> %q", a, b), t)
+	}
+
+	// Big files with a few changes stay cheap
+	big := make([]string, 200000)
+	for idx := range big {
+		big[idx] = fmt.Sprintf("line %d\n", idx)
+	}
+	changed := append([]string{}, big...)
+	changed[1000] = "changed\n"
+	changed[150000] = "changed\n"
+	MustBeInt(200002, len(diffLines(big, changed)), "ops", t)
+}
+
+func lcsLength(a []string, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] > lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
+
+func TestDiffTreesModes(t *testing.T) {
+	before := map[string]treeFile{"bin/pre-deploy.sh": {content: "echo\n", mode: 0644}}
+	after := map[string]treeFile{"bin/pre-deploy.sh": {content: "echo\n", mode: 0755}}
+	changes := diffTrees(before, after)
+	MustBeInt(1, len(changes), "change count", t)
+	MustBeString(string(Modified), string(changes[0].Status), "status", t)
+	MustBeString("old mode 100644\nnew mode 100755\n", changes[0].Diff, "mode only diff", t)
+}
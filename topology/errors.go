@@ -0,0 +1,99 @@
+package topology
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Points at what's wrong in topology.txt or in a config file
+type ParseError struct {
+	File    string // File being parsed, empty when parsing a string
+	Line    int    // 1 based, 0 when the error isn't about a specific line
+	Column  int    // 1 based, 0 when the error is about the whole line
+	Text    string // Offending line
+	Message string // What's wrong
+	Hint    string // How to fix it, optional
+}
+
+// file:line:column: message, compiler style so editors and CI logs can jump to it
+func (err *ParseError) Error() string {
+	var position []string
+	if err.File != "" {
+		position = append(position, err.File)
+	}
+	if err.Line > 0 {
+		position = append(position, fmt.Sprintf("%d", err.Line))
+		if err.Column > 0 {
+			position = append(position, fmt.Sprintf("%d", err.Column))
+		}
+	}
+	res := err.Message
+	if len(position) > 0 {
+		res = fmt.Sprintf("%s: %s", strings.Join(position, ":"), res)
+	}
+	if err.Text != "" {
+		res = fmt.Sprintf("%s: '%s'", res, strings.TrimSpace(err.Text))
+	}
+	if err.Hint != "" {
+		res = fmt.Sprintf("%s (%s)", res, err.Hint)
+	}
+	return res
+}
+
+// Every parse error found in one pass over a file
+type ParseErrors []*ParseError
+
+func (errs ParseErrors) Error() string {
+	res := make([]string, len(errs))
+	for idx, err := range errs {
+		res[idx] = err.Error()
+	}
+	return strings.Join(res, "\n")
+}
+
+// Fills in the position of errors that don't know where they come from, as in errors parsing a single value.
+// Errors that already have a file, like the ones from config files, are left alone
+func (errs ParseErrors) at(file string, line int, column int, text string) ParseErrors {
+	for _, err := range errs {
+		if err.File != "" {
+			continue
+		}
+		err.File = file
+		err.Line = line
+		if err.Column > 0 {
+			err.Column += column - 1
+		}
+		err.Text = text
+	}
+	return errs
+}
+
+// Part of a value along with its 1 based column
+type valueToken struct {
+	text   string
+	column int
+}
+
+// Splits text by separator, trimming the parts but keeping track of where each of them starts
+func splitTokens(text string, separator string, column int) []valueToken {
+	var res []valueToken
+	for _, part := range strings.Split(text, separator) {
+		trimmed := strings.TrimLeft(part, " \t")
+		res = append(res, valueToken{
+			text:   strings.TrimSpace(part),
+			column: column + len(part) - len(trimmed),
+		})
+		column += len(part) + len(separator)
+	}
+	return res
+}
+
+// 1 based column where the value of a key=value line starts
+func valueColumn(line string) int {
+	separatorIdx := strings.Index(line, KeyValueSeparator)
+	if separatorIdx < 0 {
+		return 0
+	}
+	value := line[separatorIdx+len(KeyValueSeparator):]
+	return separatorIdx + len(KeyValueSeparator) + len(value) - len(strings.TrimLeft(value, " \t")) + 1
+}
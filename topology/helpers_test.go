@@ -0,0 +1,35 @@
+package topology
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// A topology folder in a new temp dir with files in it, path in the folder -> content, and a func removing it all.
+// Topologies get built from it with BuildTopologyFromString, or buildTopology when they have to build
+func tempTopology(files map[string]string, t *testing.T) (TopologyContext, func()) {
+	tempDir, err := ioutil.TempDir("", "lazy_test")
+	if err != nil {
+		t.Fatalf("unable to create a temp topology, err: %s", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(tempDir) }
+	ctx := NewTopologyContext(tempDir)
+	for relPath, content := range files {
+		if err := ctx.appendToFile(path.Join(tempDir, relPath), content); err != nil {
+			cleanup()
+			t.Fatalf("unable to write %s, err: %s", relPath, err)
+		}
+	}
+	return ctx, cleanup
+}
+
+// Stops the test right away if topologyString doesn't build, nothing after that would make sense
+func buildTopology(ctx TopologyContext, topologyString string, t *testing.T) *Topology {
+	topology, err := BuildTopologyFromString(ctx, topologyString)
+	if err != nil {
+		t.Fatalf("unable to build the topology, err: %s", err)
+	}
+	return topology
+}
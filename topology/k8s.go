@@ -0,0 +1,172 @@
+package topology
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const K8sDeployFolder = "k8s"
+const K8sFragment = "k8s~.yml.tmpl"           // In a service folder, replaces the generated manifests
+const K8sKindPropertyName = "k8s_kind"        // StatefulSet or Deployment, in service.config
+const K8sImagePropertyName = "image"          // Container image, in service.config. The service name by default
+const K8sNodeLabel = "kubernetes.io/hostname" // Node label the node names get matched against
+const DefaultK8sKind = "StatefulSet"
+
+// deploy/k8s/<service>.yml for every service. Services with a k8s fragment get it rendered, one document per
+// instance. The others get a generated StatefulSet or Deployment with as many replicas
+// as instances, pinned to their nodes, and a Service for the ports they asked for
+type k8sTarget struct {
+	BaseTarget
+}
+
+func (target *k8sTarget) Service(ctx TopologyContext, topology Topology, service ServiceDef) error {
+	documents, err := renderK8sFragments(ctx, service.Name, topology.data)
+	if err != nil {
+		return err
+	}
+	if len(documents) == 0 {
+		manifest, err := k8sManifest(topology.serviceMetadataOf(service), service)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, manifest)
+	}
+	return ctx.appendToFile(ctx.k8sFilePath(service.Name), strings.Join(documents, "---\n"))
+}
+
+// Inherited fragments first, same as swarm-service fragments
+func renderK8sFragments(ctx TopologyContext, serviceName string, view TopologyView) ([]string, error) {
+	var res []string
+	var renderK8sFragment = func(templateFilePath string) (string, error) {
+		if !isK8sFragment(templateFilePath) {
+			return "", nil
+		}
+		results, err := RenderServiceTemplate(templateFilePath, serviceName, view)
+		if err != nil {
+			return "", err
+		}
+		for _, result := range results {
+			if !strings.HasSuffix(result, "\n") {
+				result += "\n"
+			}
+			res = append(res, result)
+		}
+		return "", nil
+	}
+	for _, serviceDir := range []string{ctx.inheritServiceDir(serviceName), ctx.serviceDir(serviceName)} {
+		_, err := withDirectory(serviceDir, renderK8sFragment)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (target *k8sTarget) ClaimsTemplate(relPath string) bool {
+	return isK8sFragment(relPath)
+}
+
+func isK8sFragment(templateFilePath string) bool {
+	return path.Base(templateFilePath) == K8sFragment
+}
+
+func k8sManifest(serviceMetadata ServiceMetadata, serviceDef ServiceDef) (string, error) {
+	kind := serviceMetadata.Config.GetString(K8sKindPropertyName, DefaultK8sKind)
+	if kind != "StatefulSet" && kind != "Deployment" {
+		return "", fmt.Errorf("'%s' service config %s needs to be StatefulSet or Deployment, got: '%s'",
+			serviceMetadata.Name, K8sKindPropertyName, kind)
+	}
+	var nodes []string
+	seen := map[string]bool{}
+	for _, instanceDef := range serviceDef.Instances {
+		if !seen[instanceDef.Node] {
+			nodes = append(nodes, instanceDef.Node)
+			seen[instanceDef.Node] = true
+		}
+	}
+	var ports []map[string]interface{}
+	for idx, port := range serviceMetadata.Ports {
+		name := fmt.Sprintf("port-%d", idx)
+		if serviceMetadata.PortNames != nil {
+			name = k8sName(serviceMetadata.PortNames[idx])
+		}
+		ports = append(ports, map[string]interface{}{"name": name, "port": port})
+	}
+	return RenderTemplateString(k8sManifestTemplate, map[string]interface{}{
+		"name":      k8sName(serviceMetadata.Name),
+		"kind":      kind,
+		"image":     serviceMetadata.Config.GetString(K8sImagePropertyName, serviceMetadata.Name),
+		"replicas":  len(serviceDef.Instances),
+		"nodes":     nodes,
+		"nodeLabel": K8sNodeLabel,
+		"ports":     ports,
+	})
+}
+
+// Kubernetes names are lower case DNS labels
+func k8sName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+}
+
+// Pods get their own IP, so containers listen on the ports the service asked for rather than the allocated ones
+const k8sManifestTemplate = `apiVersion: apps/v1
+kind: {{ .kind }}
+metadata:
+  name: {{ .name }}
+  labels:
+    app: {{ .name }}
+spec:
+{{- if eq .kind "StatefulSet" }}
+  serviceName: {{ .name }}
+{{- end }}
+  replicas: {{ .replicas }}
+  selector:
+    matchLabels:
+      app: {{ .name }}
+  template:
+    metadata:
+      labels:
+        app: {{ .name }}
+    spec:
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+              - matchExpressions:
+                  - key: {{ .nodeLabel }}
+                    operator: In
+                    values:
+{{- range .nodes }}
+                      - {{ . }}
+{{- end }}
+      containers:
+        - name: {{ .name }}
+          image: {{ .image }}
+{{- if .ports }}
+          ports:
+{{- range .ports }}
+            - name: {{ .name }}
+              containerPort: {{ .port }}
+{{- end }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .name }}
+  labels:
+    app: {{ .name }}
+spec:
+{{- if eq .kind "StatefulSet" }}
+  clusterIP: None
+{{- end }}
+  selector:
+    app: {{ .name }}
+  ports:
+{{- range .ports }}
+    - name: {{ .name }}
+      port: {{ .port }}
+      targetPort: {{ .port }}
+{{- end }}
+{{- end }}
+`
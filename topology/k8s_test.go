@@ -0,0 +1,127 @@
+package topology
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRenderK8sManifests(t *testing.T) {
+	deployDir, err := ioutil.TempDir("", "lazy_test")
+	handleTestingError(err, t)
+	defer os.RemoveAll(deployDir)
+	ctx := NewTopologyContext("testdata")
+	ctx.DeployDir = deployDir
+
+	topology, err := Load(ctx)
+	handleTestingError(err, t)
+	err = Render(ctx, *topology)
+	handleTestingError(err, t)
+
+	manifest, err := readTextFile(path.Join(deployDir, "k8s/zookeeper.yml"))
+	handleTestingError(err, t)
+	MustBeString(`apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: zookeeper
+  labels:
+    app: zookeeper
+spec:
+  serviceName: zookeeper
+  replicas: 3
+  selector:
+    matchLabels:
+      app: zookeeper
+  template:
+    metadata:
+      labels:
+        app: zookeeper
+    spec:
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+              - matchExpressions:
+                  - key: kubernetes.io/hostname
+                    operator: In
+                    values:
+                      - dev-node01
+                      - dev-node02
+      containers:
+        - name: zookeeper
+          image: zookeeper
+          ports:
+            - name: port-0
+              containerPort: 2181
+            - name: port-1
+              containerPort: 2888
+            - name: port-2
+              containerPort: 3888
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: zookeeper
+  labels:
+    app: zookeeper
+spec:
+  clusterIP: None
+  selector:
+    app: zookeeper
+  ports:
+    - name: port-0
+      port: 2181
+      targetPort: 2181
+    - name: port-1
+      port: 2888
+      targetPort: 2888
+    - name: port-2
+      port: 3888
+      targetPort: 3888
+`, manifest, "zookeeper.yml", t)
+}
+
+func TestRenderK8sFragments(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{
+		"services/app/k8s~.yml.tmpl": "kind: Pod\nname: {{ .instance.name }}",
+	}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 2\napp_cfg = 1,2:8080", t)
+	documents, err := renderK8sFragments(ctx, "app", topology.data)
+	handleTestingError(err, t)
+	MustBeInt(2, len(documents), "documents", t)
+	MustBeString("kind: Pod\nname: app-02\n", documents[1], "second document", t)
+}
+
+func TestK8sFragmentsOnlySkippedForK8sTarget(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{
+		"services/app/k8s~.yml.tmpl":      "kind: Pod\nname: {{ .instance.name }}",
+		"services/app/k8s-notes.txt.tmpl": "{{ .service.name }}",
+	}, t)
+	defer cleanup()
+	ctx.LockFile = ""
+
+	for targets, expected := range map[string]string{
+		"swarm":     "app/k8s-01.yml app/k8s-02.yml app/k8s-notes.txt",
+		"swarm,k8s": "app/k8s-notes.txt",
+	} {
+		handleTestingError(ioutil.WriteFile(ctx.topologyConfigFile(), []byte("targets = "+targets), DefaultFileMode), t)
+		topology := buildTopology(ctx, "node_count = 2\napp_cfg = 1,2:8080", t)
+		ctx.DeployDir = path.Join(ctx.topologyDir(), DeployFolder, targets)
+		handleTestingError(Render(ctx, *topology), t)
+		tree, err := readTree(ctx.DeployDir)
+		handleTestingError(err, t)
+		var appFiles []string
+		for filePath := range tree {
+			if strings.HasPrefix(filePath, "app/") {
+				appFiles = append(appFiles, filePath)
+			}
+		}
+		sort.Strings(appFiles)
+		MustBeString(expected, strings.Join(appFiles, " "), "app files with targets "+targets, t)
+	}
+}
@@ -0,0 +1,418 @@
+package topology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const DefaultSwarmStackName = "app"
+const SwarmServiceFragment = "swarm-service"
+const DefaultSwarmDeployFolder = "swarm"
+const SwarmNodeLabelsFile = "node-labels.sh" // Puts the node labels of the topology on the swarm nodes
+const StagingSuffix = ".staging"             // Render goes into .deploy.staging<random> next to the deploy folder first
+const OldSuffix = ".old"                     // Previous deploy folder while being swapped out
+const FileModeConfigPrefix = "file_mode."    // file_mode.bin/pre-deploy.sh = 0755 sets the mode of a rendered file
+
+// Renders the topology into ctx.DeployDir, replacing whatever was there before.
+// Everything gets rendered into a staging folder next to it first, the deploy folder is only swapped
+// for it once every renderer succeeded. On errors the previous deploy folder is left as it was.
+// Render doesn't touch ctx.LockFile: call WriteLock once it succeeded, as the render command does, or the next
+// builds won't get the same ports back
+func Render(ctx TopologyContext, topology Topology) error {
+	deployParentDir := path.Dir(ctx.DeployDir)
+	err := MkDirs(deployParentDir)
+	if err != nil {
+		return err
+	}
+	stagingDir, err := ioutil.TempDir(deployParentDir, fmt.Sprintf(".%s%s", path.Base(ctx.DeployDir), StagingSuffix))
+	if err != nil {
+		return err
+	}
+	// Temp dirs are private, make it look like any other rendered folder
+	err = os.Chmod(stagingDir, DefaultDirMode)
+	if err != nil {
+		_ = os.RemoveAll(stagingDir)
+		return err
+	}
+	stagingCtx := ctx
+	stagingCtx.DeployDir = stagingDir
+	stagingCtx.dirCache = NewDirCache()
+	err = renderAll(stagingCtx, topology)
+	if err != nil {
+		_ = os.RemoveAll(stagingDir)
+		return err
+	}
+	return swapDirs(stagingDir, ctx.DeployDir)
+}
+
+// Renames newDir over dir. Non empty dirs can't be renamed over, so the old one gets moved out of the way first,
+// and moved back if newDir can't take its place. That's two renames, not an atomic swap: in between dir doesn't
+// exist, and if the process dies there the previous deploy folder is left as newDir.old next to it
+func swapDirs(newDir string, dir string) error {
+	oldDir := fmt.Sprintf("%s%s", newDir, OldSuffix)
+	err := os.Rename(dir, oldDir)
+	if err != nil && !os.IsNotExist(err) {
+		_ = os.RemoveAll(newDir)
+		return err
+	}
+	hadOldDir := err == nil
+	err = os.Rename(newDir, dir)
+	if err != nil {
+		_ = os.RemoveAll(newDir)
+		if hadOldDir {
+			_ = os.Rename(oldDir, dir)
+		}
+		return err
+	}
+	if hadOldDir {
+		return os.RemoveAll(oldDir)
+	}
+	return nil
+}
+
+// Renders everything into ctx.DeployDir, which is expected to be empty
+func renderAll(ctx TopologyContext, topology Topology) error {
+	ctx.fileModes = map[string]os.FileMode{}
+	err := ctx.appendToFile(ctx.topologyJsonFile(), topology.jsonString)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.appendToFile(ctx.deployOrderFilePath(), strings.Join(topology.deployOrder, "\n")+"\n")
+	if err != nil {
+		return err
+	}
+
+	err = renderTargets(ctx, topology)
+	if err != nil {
+		return err
+	}
+
+	err = renderServiceTemplates(ctx, topology)
+	if err != nil {
+		return err
+	}
+
+	err = renderGlobalTemplates(ctx, topology)
+	if err != nil {
+		return err
+	}
+
+	err = appendServicePrePostDeploysToGlobal(ctx, topology)
+	if err != nil {
+		return err
+	}
+
+	return ctx.applyFileModes()
+}
+
+// Swarm stacks out of the swarm-service fragments, deploy/swarm/<stack>.yml
+type swarmTarget struct {
+	BaseTarget
+	stackNames []string          // In the order services first use them
+	stacks     map[string]string // Stack name -> fragments
+}
+
+func (target *swarmTarget) Service(ctx TopologyContext, topology Topology, service ServiceDef) error {
+	stackName := topology.stackOf(service)
+	// Stacks can only depend on their own services
+	dependencies := topology.dependencyInstances(service, stackName)
+	var addDependsOn = func(fragment string, instance InstanceView) string {
+		return withDependsOn(fragment, dependencies)
+	}
+	servicesString, err := renderSwarmServiceFragments(ctx, service.Name, topology.data, addDependsOn)
+	if err != nil {
+		return err
+	}
+	if _, exists := target.stacks[stackName]; !exists {
+		target.stackNames = append(target.stackNames, stackName)
+	}
+	target.stacks[stackName] += servicesString
+	return nil
+}
+
+func (target *swarmTarget) ClaimsTemplate(relPath string) bool {
+	return isSwarmServiceFragment(relPath)
+}
+
+func (target *swarmTarget) Finalize(ctx TopologyContext, topology Topology) error {
+	for _, stackName := range target.stackNames {
+		stackContent := target.stacks[stackName]
+		if stackContent == "" {
+			continue
+		}
+		swarmData := map[string]interface{}{
+			"content": stackContent,
+		}
+		var swarmStackString, err = RenderTemplateString(swarmWrapper, swarmData)
+		if err != nil {
+			return err
+		}
+		err = ctx.appendToFile(ctx.stackFilePath(stackName), swarmStackString)
+		if err != nil {
+			return err
+		}
+	}
+	if script := swarmNodeLabelsScript(topology.metadata.Nodes); script != "" {
+		return ctx.appendToFileWithMode(ctx.swarmNodeLabelsFilePath(), script, ScriptFileMode)
+	}
+	return nil
+}
+
+func (topology Topology) stackOf(serviceDef ServiceDef) string {
+	return topology.serviceMetadataOf(serviceDef).Config.GetString("stack", DefaultSwarmStackName)
+}
+
+// Script labeling the swarm nodes, so stacks can use node.labels.<label> constraints. Empty without labels
+func swarmNodeLabelsScript(nodes []NodeDef) string {
+	var commands []string
+	for _, node := range nodes {
+		var labels []string
+		for label, value := range node.Labels {
+			labels = append(labels, fmt.Sprintf("--label-add %s%s%s", label, LabelValueSeparator, value))
+		}
+		if len(labels) == 0 {
+			continue
+		}
+		sort.Strings(labels)
+		commands = append(commands, fmt.Sprintf("docker node update %s %s\n", strings.Join(labels, " "), node.Name))
+	}
+	if len(commands) == 0 {
+		return ""
+	}
+	return swarmNodeLabelsHeader + strings.Join(commands, "")
+}
+
+func isSwarmServiceFragment(relPath string) bool {
+	return strings.Contains(relPath, SwarmServiceFragment)
+}
+
+// Renders the swarm-service fragments of a service, inherited ones first. For ~ templates decorate, if not nil,
+// gets to change the fragment rendered for each instance
+func renderSwarmServiceFragments(ctx TopologyContext, serviceName string, view TopologyView,
+	decorate func(fragment string, instance InstanceView) string) (string, error) {
+
+	inheritFileScanningContext := FileScanningContext{
+		rootPath:              ctx.inheritServiceDir(serviceName),
+		pathFragment:          SwarmServiceFragment,
+		includingPathFragment: true,
+		extension:             TemplateExt,
+	}
+
+	fileScanningContext := FileScanningContext{
+		rootPath:              ctx.serviceDir(serviceName),
+		pathFragment:          SwarmServiceFragment,
+		includingPathFragment: true,
+		extension:             TemplateExt,
+	}
+
+	var renderSwarmServiceTemplate = func(templateFilePath string) (string, error) {
+		results, err := RenderServiceTemplate(templateFilePath, serviceName, view)
+		if err != nil {
+			return "", err
+		}
+		if decorate != nil && strings.Contains(templateFilePath, "~") {
+			for idx, instance := range view[serviceName].(ServiceView)["instances"].([]InstanceView) {
+				results[idx] = decorate(results[idx], instance)
+			}
+		}
+		for idx := range results {
+			results[idx] = underServices(results[idx])
+		}
+		return strings.Join(results, ""), nil
+	}
+
+	inheritServices, err := withScanningContext(inheritFileScanningContext, renderSwarmServiceTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	// TODO REALLY ADD EXCLUDES HERE AS IT'S NOT OVERWRITING, IT'S ADDING
+	services, err := withScanningContext(fileScanningContext, renderSwarmServiceTemplate)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append(inheritServices, services...), ""), nil
+}
+
+// Service templates end up in deploy/<service>, but for the ones a target claims, it renders those itself
+func renderServiceTemplates(ctx TopologyContext, topology Topology) error {
+	targets, err := topology.outputTargets()
+	if err != nil {
+		return err
+	}
+	for _, serviceDef := range topology.serviceMetadata {
+		for _, serviceDir := range []string{ctx.inheritServiceDir(serviceDef.Name), ctx.serviceDir(serviceDef.Name)} {
+			var _renderGenericTemplate = func(templateFilePath string) (string, error) {
+				relPath, err := filepath.Rel(serviceDir, templateFilePath)
+				if err != nil {
+					return "", err
+				}
+				if claimedByTarget(targets, relPath) {
+					return "", nil
+				}
+				return "", renderGenericTemplate(ctx, templateFilePath, serviceDef, topology)
+			}
+			_, err := withDirectory(serviceDir, _renderGenericTemplate)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Global templates end up full relative path in deploy folder
+// aka ./bin/__utils.sh.tmpl ends up in deploy/bin/__utils.sh
+func renderGlobalTemplates(ctx TopologyContext, topology Topology) error {
+
+	var renderGlobalTemplateFrom = func(binRootDir string) RenderTemplate {
+		return func(filePath string) (string, error) {
+			// keep only the path inside the bin folder and remove .tmpl
+			relPath, err := filepath.Rel(binRootDir, filePath)
+			if err != nil {
+				return "", err
+			}
+			outRelPath := strings.TrimSuffix(path.Join(BinFolder, relPath), TemplateExt)
+			res, err := RenderGlobalTemplate(filePath, topology)
+			if err != nil {
+				return "", err
+			}
+			mode, err := renderedFileMode(filePath, outRelPath, topology.metadata.Config)
+			if err != nil {
+				return "", err
+			}
+			return "", ctx.appendToFileWithMode(ctx.deployFilePath(outRelPath), res, mode)
+		}
+	}
+	// Non existing paths will be ignored
+	_, err := withDirectory(ctx.rootInheritBinFolder(), renderGlobalTemplateFrom(ctx.rootInheritBinFolder()))
+	if err != nil {
+		return err
+	}
+	_, err = withDirectory(ctx.binDir(), renderGlobalTemplateFrom(ctx.binDir()))
+	return err
+}
+
+func appendServicePrePostDeploysToGlobal(ctx TopologyContext, topology Topology) error {
+	// TODO Should this actually be prepend? Aka service post deploy THEN global post deploy
+	err := appendDeployToGlobal(ctx, "post-deploy.sh", topology)
+	if err != nil {
+		return err
+	}
+	return appendDeployToGlobal(ctx, "pre-deploy.sh", topology)
+}
+
+func appendDeployToGlobal(ctx TopologyContext, fileName string, topology Topology) error {
+	deployFile := path.Join(ctx.DeployDir, BinFolder, fileName)
+	if _, err := os.Stat(deployFile); err == nil {
+		for _, serviceDef := range metadataInDeployOrder(topology.serviceMetadata, topology.deployOrder) {
+			servicePostDeployFile := path.Join(ctx.DeployDir, serviceDef.Name, BinFolder, fileName)
+			if _, err := os.Stat(servicePostDeployFile); err == nil {
+				content, err := readTextFile(servicePostDeployFile)
+				if err != nil {
+					return err
+				}
+				content = strings.ReplaceAll(content, "#!/usr/bin/env bash\n", "")
+				err = ctx.appendToFile(deployFile, content)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func renderGenericTemplate(ctx TopologyContext, templateFilePath string, serviceDef ServiceMetadata, topology Topology) error {
+	results, err := RenderServiceTemplate(templateFilePath, serviceDef.Name, topology.data)
+	if err != nil {
+		return err
+	}
+	tmp := strings.ReplaceAll(templateFilePath, ctx.inheritServiceDir(serviceDef.Name), ctx.serviceDir(serviceDef.Name))
+	// RawConfig leaves the topology config out, its file_mode keys are relative to the topology folder
+	serviceRelPath, err := filepath.Rel(ctx.serviceDir(serviceDef.Name), tmp)
+	if err != nil {
+		return err
+	}
+	mode, err := renderedFileMode(templateFilePath, strings.TrimSuffix(serviceRelPath, TemplateExt), serviceDef.RawConfig)
+	if err != nil {
+		return err
+	}
+	for idx, res := range results {
+		relPath, err := filepath.Rel(ctx.ServicesDir, tmp)
+		if err != nil {
+			return err
+		}
+		tmp := strings.ReplaceAll(ctx.deployFilePath(relPath), TemplateExt, "")
+		resultFilePath := strings.ReplaceAll(tmp, "~", fmt.Sprintf("-%s", nodeId(idx)))
+		err = ctx.appendToFileWithMode(resultFilePath, res, mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type FileScanningContext struct {
+	rootPath              string
+	pathFragment          string
+	includingPathFragment bool
+	extension             string
+}
+
+type RenderTemplate func(templateFilePath string) (string, error)
+
+func withScanningContext(ctx FileScanningContext, render RenderTemplate) ([]string, error) {
+	var res []string
+	err := filepath.Walk(ctx.rootPath, func(templateFilePath string, handle os.FileInfo, err error) error {
+		nameMatches := ctx.includingPathFragment && strings.Contains(templateFilePath, ctx.pathFragment) ||
+			!ctx.includingPathFragment && !strings.Contains(templateFilePath, ctx.pathFragment)
+		if handle != nil && !handle.IsDir() && nameMatches && path.Ext(handle.Name()) == ctx.extension {
+			tmp, err := render(templateFilePath)
+			if err != nil {
+				return err
+			}
+			res = append(res, tmp)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func withDirectory(rootPath string, render RenderTemplate) ([]string, error) {
+	var res []string
+	err := filepath.Walk(rootPath, func(templateFilePath string, handle os.FileInfo, err error) error {
+		if handle != nil && !handle.IsDir() && path.Ext(handle.Name()) == TemplateExt {
+			tmp, err := render(templateFilePath)
+			if err != nil {
+				return err
+			}
+			res = append(res, tmp)
+		}
+		return nil
+	})
+	return res, err
+}
+
+const swarmNodeLabelsHeader = `#!/usr/bin/env bash
+# Run against a swarm manager before deploying the stacks
+set -e
+`
+
+const swarmWrapper = `# No good reason this is 3.7
+version: "3.7"
+
+services:
+{{ .content }}
+networks:
+  host_net:
+    external: true
+    name: host
+
+`
@@ -0,0 +1,175 @@
+package topology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestRenderAllFor(t *testing.T) {
+	deployDir, err := ioutil.TempDir("", "lazy_test")
+	handleTestingError(err, t)
+	defer os.RemoveAll(deployDir)
+	ctx := NewTopologyContext("testdata")
+	ctx.DeployDir = deployDir
+
+	topology, err := Load(ctx)
+	handleTestingError(err, t)
+	err = Render(ctx, *topology)
+	handleTestingError(err, t)
+
+	for _, filePath := range []string{"topology.json", "swarm/kafka.yml", "bin/pre-deploy.sh",
+		"zookeeper/config/zoo-01.cfg", "zookeeper/config/zoo-02.cfg", "zookeeper/config/zoo-03.cfg"} {
+		if _, err := os.Stat(path.Join(deployDir, filePath)); err != nil {
+			t.Errorf("%s should have been rendered, err: %s", filePath, err)
+		}
+	}
+	zooCfg, err := readTextFile(path.Join(deployDir, "zookeeper/config/zoo-02.cfg"))
+	handleTestingError(err, t)
+	MustBeString(`clientPort=2182
+server.0=dev-node01:2888:3888
+server.1=dev-node01:2889:3889
+server.2=dev-node02:2888:3888
+
+`, zooCfg, "zoo-02.cfg", t)
+}
+
+func TestRenderKeepsDeployOnError(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "lazy_test")
+	handleTestingError(err, t)
+	defer os.RemoveAll(tempDir)
+	// testdata/invalid has a template that doesn't parse
+	ctx := NewTopologyContext("testdata/invalid")
+	ctx.DeployDir = path.Join(tempDir, "deploy")
+	err = ctx.appendToFile(path.Join(ctx.DeployDir, "previous.txt"), "previous render")
+	handleTestingError(err, t)
+
+	topology, err := Load(ctx)
+	handleTestingError(err, t)
+	if err = Render(ctx, *topology); err == nil {
+		t.Errorf("render should fail")
+	}
+	previous, err := readTextFile(path.Join(ctx.DeployDir, "previous.txt"))
+	handleTestingError(err, t)
+	MustBeString("previous render", previous, "previous render", t)
+	files, err := ioutil.ReadDir(tempDir)
+	handleTestingError(err, t)
+	MustBeInt(1, len(files), "files next to the deploy folder", t)
+}
+
+// Hundreds of instances with a few small files each, mostly spent creating folders and writing files
+func BenchmarkRender(b *testing.B) {
+	tempDir, err := ioutil.TempDir("", "lazy_bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	topologyString, err := readTextFile("testdata/bench/topology.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	nodeIDs := strings.TrimSuffix(strings.Repeat("1,2,3,4,5,", 100), ",")
+	topologyString = strings.ReplaceAll(topologyString, "1,2,3,4,5:", nodeIDs+":")
+	ctx := NewTopologyContext("testdata/bench")
+	ctx.DeployDir = path.Join(tempDir, "deploy")
+	topology, err := BuildTopologyFromString(ctx, topologyString)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Render(ctx, *topology); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRenderFileModes(t *testing.T) {
+	deployDir, err := ioutil.TempDir("", "lazy_test")
+	handleTestingError(err, t)
+	defer os.RemoveAll(deployDir)
+	ctx := NewTopologyContext("testdata")
+	ctx.DeployDir = deployDir
+	topology, err := Load(ctx)
+	handleTestingError(err, t)
+	handleTestingError(Render(ctx, *topology), t)
+
+	for filePath, mode := range map[string]string{
+		"topology.json":               "-rw-r--r--", // default
+		"bin/pre-deploy.sh":           "-rwxr-xr-x", // template file mode
+		"zookeeper/bin/pre-deploy.sh": "-rwxr-x---", // front matter
+		"zookeeper/config/zoo-01.cfg": "-rw-------", // service config
+	} {
+		info, err := os.Stat(path.Join(deployDir, filePath))
+		handleTestingError(err, t)
+		MustBeString(mode, info.Mode().String(), filePath+" mode", t)
+	}
+	preDeploy, err := readTextFile(path.Join(deployDir, "zookeeper/bin/pre-deploy.sh"))
+	handleTestingError(err, t)
+	MustBeString("#!/usr/bin/env bash\necho \"zookeeper has 3 instances\"\n", preDeploy, "front matter is gone", t)
+}
+
+func TestRenderAppendsToReadOnlyFiles(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{
+		"topology.config":                       "file_mode.bin/pre-deploy.sh = 0555",
+		"bin/pre-deploy.sh.tmpl":                "#!/usr/bin/env bash\necho global\n",
+		"services/kafka/bin/pre-deploy.sh.tmpl": "#!/usr/bin/env bash\necho kafka\n",
+	}, t)
+	defer cleanup()
+	ctx.LockFile = ""
+	topology := buildTopology(ctx, "node_count = 1\nkafka_cfg = 1:9092", t)
+	handleTestingError(Render(ctx, *topology), t)
+
+	preDeployPath := path.Join(ctx.DeployDir, BinFolder, "pre-deploy.sh")
+	preDeploy, err := readTextFile(preDeployPath)
+	handleTestingError(err, t)
+	MustBeString("#!/usr/bin/env bash\necho global\necho kafka\n", preDeploy, "appended pre-deploy.sh", t)
+	info, err := os.Stat(preDeployPath)
+	handleTestingError(err, t)
+	MustBeString("-r-xr-xr-x", info.Mode().String(), "pre-deploy.sh mode", t)
+}
+
+func TestRenderIsDeterministic(t *testing.T) {
+	files := map[string]string{
+		"topology.config": "targets = swarm,compose,k8s,ansible,terraform\n" +
+			"node.1.labels = ssd,zone=eu,big\nnode.2.labels = rack=r2,ssd",
+	}
+	for _, service := range []string{"kafka", "zookeeper", "connect", "schema"} {
+		files[path.Join(ServicesFolder, service, ServiceConfigFile)] = "stack = " + service + "\n" +
+			"ENV_A = 1\nENV_B = 2\nENV_C = 3\nENV_D = 4\nurl.a = x\nurl.b = y\nurl.c = z"
+		files[path.Join(ServicesFolder, service, SwarmServiceFragment, service+"~.yml.tmpl")] =
+			"  {{ .instance.name }}:\n    environment:\n      ENV_LAZY_PLACEHOLDER\n" +
+				"    labels: [{{ join \",\" (grep_key \"url.\" .service.config) }}]\n" +
+				"    extra: [{{ join \",\" (grep_1st_value \"\" .service.config) }}]\n"
+	}
+	files[path.Join(ServicesFolder, "connect", ServiceConfigFile)] += "\ndepends_on = kafka,schema"
+	ctx, cleanup := tempTopology(files, t)
+	defer cleanup()
+	ctx.LockFile = ""
+	topologyString := "node_count = 2\nkafka_cfg = 1,2:9092\nzookeeper_cfg = spread(3):2181\n" +
+		"connect_cfg = all:8083\nschema_cfg = binpack(2):8081"
+
+	var first map[string]treeFile
+	for idx := 0; idx < 5; idx++ {
+		topology := buildTopology(ctx, topologyString, t)
+		ctx.DeployDir = path.Join(ctx.topologyDir(), DeployFolder, fmt.Sprintf("%d", idx))
+		handleTestingError(Render(ctx, *topology), t)
+		tree, err := readTree(ctx.DeployDir)
+		handleTestingError(err, t)
+		if first == nil {
+			first = tree
+			continue
+		}
+		for _, change := range diffTrees(first, tree) {
+			t.Errorf("render %d differs from the first one:\n%s", idx, change.Diff)
+		}
+	}
+	stack := first["swarm/connect.yml"].content
+	if !strings.Contains(stack, "      A: 1\n      B: 2\n      C: 3\n      D: 4\n    labels") ||
+		!strings.Contains(stack, "labels: [x,y,z]") {
+		t.Errorf("placeholders and grep helpers should render in key order, got:\n%s", stack)
+	}
+}
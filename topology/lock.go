@@ -0,0 +1,99 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const LockFile = "topology.lock" // Ports handed out by earlier renders, meant to be committed along with topology.txt
+
+// Ports an instance got, as long as it stays on the same node and its service asks for the same ports
+type lockedInstance struct {
+	Node      string `json:"node"`
+	BasePorts []int  `json:"base_ports"`
+	Ports     []int  `json:"ports"`
+}
+
+// Instance name -> its locked ports. Missing lock file, or no lock file at all in ctx, is an empty lock
+func readLock(ctx TopologyContext) (map[string]lockedInstance, error) {
+	res := map[string]lockedInstance{}
+	if ctx.LockFile == "" {
+		return res, nil
+	}
+	content, err := ioutil.ReadFile(ctx.LockFile)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &res)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w, remove it to allocate every port again", ctx.LockFile, err)
+	}
+	return res, nil
+}
+
+// Locks the ports of every instance in the topology, for the next builds to reuse. Instances that are gone
+// get dropped. The lock file is only written when it changes, Render leaves it to the caller
+func WriteLock(ctx TopologyContext, topology Topology) error {
+	if ctx.LockFile == "" {
+		return nil
+	}
+	lock := map[string]lockedInstance{}
+	for _, serviceDef := range topology.services {
+		basePorts := topology.serviceMetadataOf(serviceDef).Ports
+		for _, instanceDef := range serviceDef.Instances {
+			lock[instanceDef.Name] = lockedInstance{Node: instanceDef.Node, BasePorts: basePorts, Ports: instanceDef.Ports}
+		}
+	}
+	content, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if previous, err := readTextFile(ctx.LockFile); err == nil && previous == string(content)+"\n" {
+		return nil
+	}
+	return ioutil.WriteFile(ctx.LockFile, append(content, '\n'), DefaultFileMode)
+}
+
+// Claims the locked ports of the instances still on the same node and asking for the same ports, before any other
+// port gets allocated. Locked ports that got reserved or taken meanwhile make the instance get new ones
+func (allocator *portAllocator) claimLocked(lock map[string]lockedInstance, serviceMetadataList []ServiceMetadata, nodeNames []string) {
+	for _, service := range serviceMetadataList {
+		for idx, nodeID := range service.NodeIDs {
+			name := instanceName(service.Name, idx)
+			locked, exists := lock[name]
+			if !exists || locked.Node != nodeNames[nodeID-1] || !sameInts(locked.BasePorts, service.Ports) ||
+				len(locked.Ports) != len(service.Ports) {
+				continue
+			}
+			free := true
+			for _, port := range locked.Ports {
+				free = free && port <= allocator.maxPort && allocator.taken[portKey(locked.Node, port)] == "" &&
+					!allocator.isReserved(locked.Node, port)
+			}
+			if !free {
+				continue
+			}
+			for portIdx, port := range locked.Ports {
+				allocator.take(locked.Node, port, service.Name, name, service.Ports[portIdx])
+			}
+			allocator.claimed[name] = locked.Ports
+		}
+	}
+}
+
+func sameInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
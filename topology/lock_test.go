@@ -0,0 +1,39 @@
+package topology
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLockKeepsPorts(t *testing.T) {
+	ctx, cleanup := tempTopology(nil, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 2\nkafka_cfg = 1,2:9092\nzookeeper_cfg = 1:9092", t)
+	err := WriteLock(ctx, *topology)
+	handleTestingError(err, t)
+
+	// zookeeper would get 9092 on node 1 without the lock, metrics fills the gaps left
+	topology = buildTopology(ctx, "node_count = 2\nmetrics_cfg = 1,1:9092\nzookeeper_cfg = 1:9092\nkafka_cfg = 1,2:9092", t)
+	for service, expected := range map[string]string{"kafka": "[[9092] [9092]]", "zookeeper": "[[9093]]", "metrics": "[[9094] [9095]]"} {
+		serviceDef, _ := topology.Service(service)
+		var ports [][]int
+		for _, instanceDef := range serviceDef.Instances {
+			ports = append(ports, instanceDef.Ports)
+		}
+		MustBeString(expected, fmt.Sprint(ports), service+" ports", t)
+	}
+}
+
+func TestLockDropsMovedInstances(t *testing.T) {
+	ctx, cleanup := tempTopology(nil, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 2\nkafka_cfg = 1,1:9092", t)
+	err := WriteLock(ctx, *topology)
+	handleTestingError(err, t)
+
+	topology = buildTopology(ctx, "node_count = 2\nkafka_cfg = 1,2:9092", t)
+	kafka, _ := topology.Service("kafka")
+	MustBeString("[9092] [9092]", fmt.Sprint(kafka.Instances[0].Ports, kafka.Instances[1].Ports), "kafka ports", t)
+}
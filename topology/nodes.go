@@ -0,0 +1,258 @@
+package topology
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const NodeLabelsPropertyName = "labels"        // node.3.labels = ssd,zone=eu, labels without a value are true
+const NodeIPPropertyName = "ip"                // node.3.ip = 10.0.0.13
+const NodeHostnamePropertyName = "hostname"    // node.3.hostname = kafka-box, instead of the hostname_prefix one
+const NodeLabelsConstraintName = "node_labels" // node_labels = ssd in service.config only places instances on nodes labeled ssd
+const NodesPropertyName = "nodes"              // nodes = alpha,beta,gamma in topology.txt, instead of node_count and hostname_prefix
+const NodesFilePropertyName = "nodes_file"     // nodes_file = nodes.txt in topology.txt, a '<hostname> [<address>]' line per node
+const LabelValueSeparator = "="
+const DefaultLabelValue = "true"
+
+// A cluster node, described by the node.<node id>.<key> lines of topology.txt and topology.config
+type NodeDef struct {
+	ID         int               `json:"id"` // 1 based, as in topology.txt
+	Name       string            `json:"name"`
+	IP         string            `json:"ip,omitempty"`
+	Labels     map[string]string `json:"labels"`
+	Attributes map[string]string `json:"attributes"` // Every other node.<node id>.<key>, reserved_ports included
+}
+
+// Whether the node carries every label, labels without a value only need to be there
+func (node NodeDef) hasLabels(labels map[string]string) bool {
+	for key, value := range labels {
+		nodeValue, exists := node.Labels[key]
+		if !exists || value != DefaultLabelValue && value != nodeValue {
+			return false
+		}
+	}
+	return true
+}
+
+// Nodes listed by nodes or nodes_file in topology.txt, nil when node_count and hostname_prefix make them up.
+// values and lineIdxs are the topology.txt key value pairs and their line index
+func listedNodes(ctx TopologyContext, lines []string, values map[string]string, lineIdxs map[string]int) ([]NodeDef, ParseErrors) {
+	var errorAt = func(key string, err *ParseError) ParseErrors {
+		lineIdx := lineIdxs[key]
+		return ParseErrors{err}.at(ctx.TopologyFile, lineIdx+1, valueColumn(lines[lineIdx]), lines[lineIdx])
+	}
+	nodeList, hasNodes := values[NodesPropertyName]
+	nodesFile, hasNodesFile := values[NodesFilePropertyName]
+	if hasNodes && hasNodesFile {
+		return nil, errorAt(NodesFilePropertyName, &ParseError{
+			Message: fmt.Sprintf("'%s' and '%s' can't be used together", NodesPropertyName, NodesFilePropertyName),
+			Hint:    "list the nodes in one place",
+		})
+	}
+	var nodes []NodeDef
+	var errs ParseErrors
+	key := NodesPropertyName
+	if hasNodes {
+		for _, token := range splitTokens(nodeList, ValueSeparator, 1) {
+			if token.text != "" {
+				nodes = append(nodes, NodeDef{Name: token.text})
+			}
+		}
+	} else if hasNodesFile {
+		key = NodesFilePropertyName
+		if !path.IsAbs(nodesFile) {
+			nodesFile = path.Join(ctx.topologyDir(), nodesFile)
+		}
+		content, err := readTextFile(nodesFile)
+		if err != nil {
+			return nil, errorAt(key, &ParseError{Message: err.Error()})
+		}
+		for idx, line := range strings.Split(content, "\n") {
+			if shouldIgnore(strings.TrimSpace(line)) {
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) > 2 {
+				errs = append(errs, &ParseError{
+					File:    nodesFile,
+					Line:    idx + 1,
+					Text:    line,
+					Message: "incorrect line format",
+					Hint:    "use <hostname> [<address>]",
+				})
+				continue
+			}
+			node := NodeDef{Name: fields[0]}
+			if len(fields) == 2 {
+				node.IP = fields[1]
+			}
+			nodes = append(nodes, node)
+		}
+	} else {
+		return nil, nil
+	}
+	if len(nodes) == 0 && len(errs) == 0 {
+		return nil, errorAt(key, &ParseError{Message: "no nodes listed", Hint: "list at least one node"})
+	}
+	names := map[string]bool{}
+	for _, node := range nodes {
+		if names[node.Name] {
+			errs = append(errs, errorAt(key, &ParseError{
+				Message: fmt.Sprintf("node '%s' is listed more than once", node.Name),
+				Hint:    "node hostnames need to be unique",
+			})...)
+		}
+		names[node.Name] = true
+	}
+	return nodes, errs
+}
+
+// The nodes of the topology: listed ones or, when nil, nodeCount nodes named after the hostname_prefix, then
+// described by node.<node id or name>.<key> configs. keyLines has the topology.txt line index of the node keys coming
+// from there, the other ones come from configFile
+func nodesFrom(config Config, listed []NodeDef, nodeCount int, topologyFile string, lines []string,
+	keyLines map[string]int, configFile string) ([]NodeDef, error) {
+
+	nodeNamePrefix := config.GetString(NodeNamePrefixPropertyName, DefaultNodeNamePrefix)
+	nodes := make([]NodeDef, nodeCount)
+	for idx := range nodes {
+		nodes[idx] = NodeDef{
+			ID:         idx + 1,
+			Name:       nodeName(nodeNamePrefix, idx),
+			Labels:     map[string]string{},
+			Attributes: map[string]string{},
+		}
+		if listed != nil {
+			nodes[idx].Name = listed[idx].Name
+			nodes[idx].IP = listed[idx].IP
+		}
+	}
+	names := nodeNamesOf(nodes) // Before hostname configs rename them
+	var errs ParseErrors
+	var errorAt = func(key string, err *ParseError) {
+		if lineIdx, exists := keyLines[key]; exists {
+			errs = append(errs, ParseErrors{err}.at(topologyFile, lineIdx+1, valueColumn(lines[lineIdx]), lines[lineIdx])...)
+		} else {
+			err.File = configFile
+			err.Text = fmt.Sprintf("%s %s %s", key, KeyValueSeparator, config.GetString(key, ""))
+			errs = append(errs, err)
+		}
+	}
+	var keys []string
+	for key := range config.data {
+		if strings.HasPrefix(key, NodePropertyPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	// Config file keys first, then the topology.txt ones in line order
+	sort.Slice(keys, func(i, j int) bool {
+		iLine, iInTopology := keyLines[keys[i]]
+		jLine, jInTopology := keyLines[keys[j]]
+		if iInTopology != jInTopology {
+			return jInTopology
+		}
+		if iInTopology {
+			return iLine < jLine
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		value := config.GetString(key, "")
+		idAndName := strings.SplitN(strings.TrimPrefix(key, NodePropertyPrefix), ".", 2)
+		nodeID, err := strconv.Atoi(idAndName[0])
+		for idx, name := range names {
+			if strings.HasPrefix(key, fmt.Sprintf("%s%s.", NodePropertyPrefix, name)) {
+				nodeID, err = idx+1, nil
+				idAndName = []string{name, strings.TrimPrefix(key, fmt.Sprintf("%s%s.", NodePropertyPrefix, name))}
+			}
+		}
+		if err != nil || len(idAndName) < 2 || idAndName[1] == "" {
+			errorAt(key, &ParseError{
+				Message: fmt.Sprintf("'%s' isn't a node key", key),
+				Hint: fmt.Sprintf("use %s<node id or name>.<key>, as in %s3.%s", NodePropertyPrefix, NodePropertyPrefix,
+					NodeIPPropertyName),
+			})
+			continue
+		}
+		if nodeID < 1 || nodeID > nodeCount {
+			errorAt(key, &ParseError{
+				Message: fmt.Sprintf("node %d of '%s' doesn't exist", nodeID, key),
+				Hint:    fmt.Sprintf("node ids go from 1 to %s (%d)", NodeCountPropertyName, nodeCount),
+			})
+			continue
+		}
+		node := &nodes[nodeID-1]
+		switch idAndName[1] {
+		case NodeLabelsPropertyName:
+			labels, err := parseLabels(value)
+			if err != nil {
+				errorAt(key, err)
+				continue
+			}
+			node.Labels = labels
+		case NodeIPPropertyName:
+			node.IP = value
+		case NodeHostnamePropertyName:
+			node.Name = value
+		default:
+			node.Attributes[idAndName[1]] = value
+		}
+	}
+	nodeIDs := map[string]int{}
+	for _, node := range nodes {
+		if otherID, exists := nodeIDs[node.Name]; exists {
+			// Point at the hostname config renaming one of them
+			key := fmt.Sprintf("%s%d.%s", NodePropertyPrefix, otherID, NodeHostnamePropertyName)
+			for _, hostnameKey := range keys {
+				if strings.HasSuffix(hostnameKey, NodeHostnamePropertyName) && config.GetString(hostnameKey, "") == node.Name {
+					key = hostnameKey
+				}
+			}
+			errorAt(key, &ParseError{
+				Message: fmt.Sprintf("nodes %d and %d are both named '%s'", otherID, node.ID, node.Name),
+				Hint:    "node hostnames need to be unique",
+			})
+		}
+		nodeIDs[node.Name] = node.ID
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return nodes, nil
+}
+
+// ssd,zone=eu -> {ssd: true, zone: eu}
+func parseLabels(value string) (map[string]string, *ParseError) {
+	res := map[string]string{}
+	for _, token := range splitTokens(value, ValueSeparator, 1) {
+		if token.text == "" {
+			continue
+		}
+		keyAndValue := strings.SplitN(token.text, LabelValueSeparator, 2)
+		label := strings.TrimSpace(keyAndValue[0])
+		labelValue := DefaultLabelValue
+		if len(keyAndValue) == 2 {
+			labelValue = strings.TrimSpace(keyAndValue[1])
+		}
+		if label == "" || labelValue == "" {
+			return nil, &ParseError{
+				Column:  token.column,
+				Message: fmt.Sprintf("label '%s' isn't valid", token.text),
+				Hint:    fmt.Sprintf("use <label> or <label>%s<value>, as in ssd,zone%seu", LabelValueSeparator, LabelValueSeparator),
+			}
+		}
+		res[label] = labelValue
+	}
+	return res, nil
+}
+
+func nodeNamesOf(nodes []NodeDef) []string {
+	res := make([]string, len(nodes))
+	for idx, node := range nodes {
+		res[idx] = node.Name
+	}
+	return res
+}
@@ -0,0 +1,96 @@
+package topology
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNodeAttributes(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{
+		"topology.config": "node.2.labels = big\nnode.3.labels = ssd\nnode.3.rack = r1",
+	}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx,
+		"node_count = 3\nnode.3.labels = ssd, zone=eu\nnode.3.ip = 10.0.0.13\nnode.1.hostname = alpha\nkafka_cfg = 1,3:9092", t)
+	MustBeString("[alpha dev-node02 dev-node03]", fmt.Sprint(topology.NodeNames()), "node names", t)
+	node := topology.metadata.Nodes[2]
+	MustBeString("10.0.0.13", node.IP, "ip", t)
+	MustBeString("map[ssd:true zone:eu]", fmt.Sprint(node.Labels), "topology.txt labels win", t)
+	MustBeString("map[rack:r1]", fmt.Sprint(node.Attributes), "attributes", t)
+	MustBeString("alpha", nodeIDsOf(topology, "kafka", t)[1:6], "instance node", t)
+
+	res, err := RenderTemplateString(`{{ range .topology.kafka.instances }}{{ .node }} {{ .node_ip }} {{ .node_labels.zone }};{{ end }}`+
+		`{{ range .topology.nodes }}{{ .id }}={{ .name }} {{ end }}`, map[string]interface{}{"topology": topology.data})
+	handleTestingError(err, t)
+	MustBeString("alpha  <no value>;dev-node03 10.0.0.13 eu;1=alpha 2=dev-node02 3=dev-node03 ", res, "node data", t)
+	MustBeString("docker node update --label-add big=true dev-node02\ndocker node update --label-add ssd=true --label-add zone=eu dev-node03\n",
+		swarmNodeLabelsScript(topology.metadata.Nodes)[len(swarmNodeLabelsHeader):], "node labels script", t)
+}
+
+func TestInvalidNodeAttributes(t *testing.T) {
+	ctx := NewTopologyContext("testdata")
+	_, err := BuildTopologyFromString(ctx, "node_count = 2\nnode.3.ip = 10.0.0.13\nnode.1.labels = ssd,=eu\nnode.x = y")
+	MustBeString(fmt.Sprintf("%s:2: node 3 of 'node.3.ip' doesn't exist: 'node.3.ip = 10.0.0.13' (node ids go from 1 to node_count (2))\n", ctx.TopologyFile)+
+		fmt.Sprintf("%s:3:21: label '=eu' isn't valid: 'node.1.labels = ssd,=eu' (use <label> or <label>=<value>, as in ssd,zone=eu)\n", ctx.TopologyFile)+
+		fmt.Sprintf("%s:4: 'node.x' isn't a node key: 'node.x = y' (use node.<node id or name>.<key>, as in node.3.ip)", ctx.TopologyFile),
+		fmt.Sprint(err), "error", t)
+
+	_, err = BuildTopologyFromString(ctx, "node_count = 2\nnode.2.hostname = dev-node01")
+	MustBeString(fmt.Sprintf("%s:2: nodes 1 and 2 are both named 'dev-node01': 'node.2.hostname = dev-node01' (node hostnames need to be unique)", ctx.TopologyFile),
+		fmt.Sprint(err), "error", t)
+}
+
+func TestNodeLabelsPlacement(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"services/kafka/service.config": "node_labels = ssd"}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 3\nnode.1.labels = ssd\nnode.3.labels = ssd,big\nkafka_cfg = spread(2):9092", t)
+	MustBeString("[dev-node01 dev-node03]", nodeIDsOf(topology, "kafka", t), "kafka nodes", t)
+
+	_, err := BuildTopologyFromString(ctx, "node_count = 3\nnode.1.labels = ssd\nkafka_cfg = 1,2:9092")
+	MustBeString(fmt.Sprintf("%s:3: node 2 (dev-node02) lacks the node_labels of 'kafka' (ssd) "+
+		"(label it with node.2.labels or pick another node)", ctx.TopologyFile), fmt.Sprint(err), "error", t)
+
+	topology = buildTopology(ctx, "node_count = 1\nnode.1.labels = ssd\nkafka_cfg = 1:9092", t)
+	handleTestingError(Render(ctx, *topology), t)
+	info, err := os.Stat(ctx.swarmNodeLabelsFilePath())
+	handleTestingError(err, t)
+	MustBeString(ScriptFileMode.String(), info.Mode().String(), "node labels script mode", t)
+}
+
+func TestListedNodes(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{
+		"topology.config": "node.beta.labels = ssd",
+		"nodes.txt":       "# hostname address\nalpha 10.0.0.1\n\nbeta\n",
+	}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "nodes = alpha, beta,gamma\nkafka_cfg = 2,3:9092", t)
+	MustBeInt(3, topology.metadata.NodeCount, "node count", t)
+	MustBeString("[beta gamma]", nodeIDsOf(topology, "kafka", t), "kafka nodes", t)
+	MustBeString("map[ssd:true]", fmt.Sprint(topology.metadata.Nodes[1].Labels), "labels by node name", t)
+
+	topology = buildTopology(ctx, "node_count = 2\nnodes_file = nodes.txt\nkafka_cfg = all:9092", t)
+	MustBeString("[alpha beta]", fmt.Sprint(topology.NodeNames()), "node names", t)
+	MustBeString("10.0.0.1", topology.metadata.Nodes[0].IP, "ip", t)
+	MustBeString("all:\n  hosts:\n    alpha:\n      ansible_host: 10.0.0.1\n    beta:\n",
+		ansibleInventory(*topology)[:len("all:\n  hosts:\n    alpha:\n      ansible_host: 10.0.0.1\n    beta:\n")],
+		"inventory", t)
+
+	_, err := BuildTopologyFromString(ctx, "node_count = 3\nnodes = alpha,alpha")
+	MustBeString(fmt.Sprintf("%s:2: node 'alpha' is listed more than once: 'nodes = alpha,alpha' (node hostnames need to be unique)\n", ctx.TopologyFile)+
+		fmt.Sprintf("%s:1:14: 'node_count' is 3 but 2 nodes are listed: 'node_count = 3' (drop node_count, listed nodes set it)", ctx.TopologyFile),
+		fmt.Sprint(err), "error", t)
+}
+
+func TestNodesIsntAServiceName(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"bin/pre-deploy.sh.tmpl": "{{ range .topology.services }}{{ .name }}{{ end }}"}, t)
+	defer cleanup()
+	_, err := BuildTopologyFromString(ctx, "node_count = 2\nnodes_cfg = 1,2:9100")
+	if err == nil || !strings.Contains(err.Error(), "service name 'nodes' is reserved") {
+		t.Errorf("a nodes service should fail the build, got: %v", err)
+	}
+}
@@ -0,0 +1,568 @@
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Config struct {
+	data map[string]string
+}
+
+func (config Config) GetString(name string, dfolt string) string {
+	var tmp, exists = config.data[name]
+	if exists {
+		return tmp
+	}
+	return dfolt
+}
+
+// Copy of all the config key value pairs
+func (config Config) Data() map[string]string {
+	res := map[string]string{}
+	for key, v := range config.data {
+		res[key] = v
+	}
+	return res
+}
+
+func (config Config) dataForRender() map[string]interface{} {
+	res := map[string]interface{}{}
+	for key, v := range config.data {
+		res[key] = v
+	}
+	topologyData := map[string]interface{}{}
+	topologyConfigData := map[string]interface{}{}
+	topologyConfigData["config"] = res
+	topologyData["topology"] = topologyConfigData
+	return topologyData
+}
+
+type TopologyMetadata struct {
+	NodeCount   int
+	NodeNames   []string  // Node id - 1 -> node name
+	Nodes       []NodeDef // Node id - 1 -> node
+	NodesListed bool      // Nodes come from nodes or nodes_file, rather than node_count and hostname_prefix
+	Config      Config
+}
+
+type ServiceMetadata struct {
+	Name      string     // zookeeper
+	NodeIDs   []int      // 1,2,3 -> [1, 2, 3]
+	Ports     []int      // 2181,2888,3888 -> [2181, 2888, 3888]
+	PortNames []string   // client=2181,peer=2888 -> [client, peer], nil for unnamed ports
+	Placement *Placement // spread(3) -> spread 3 instances, nil for explicit node ids. Placing them fills in NodeIDs
+	Config    Config
+	RawConfig Config
+	Line      int // topology.txt line it's defined on, 1 based
+}
+
+func ReadKeyValuePair(line string) (string, string, error) {
+	if ! strings.Contains(line, KeyValueSeparator) {
+		return "", "", errors.New("incorrect line format. Use: key=value")
+	}
+	keyAndValue := strings.Split(strings.TrimSpace(line), KeyValueSeparator)
+	key := strings.TrimSpace(keyAndValue[0])
+	// if it split in more than 2, it means value contains at least one KeyValueSeparator and we need to join by it
+	value := strings.TrimSpace(strings.Join(keyAndValue[1:], KeyValueSeparator))
+	return key, value, nil
+}
+
+func TopologyMetadataFromLines(ctx TopologyContext, lines []string) (*TopologyMetadata, error) {
+	var errs ParseErrors
+	res := map[string]string{}
+	lineIdxs := map[string]int{}
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if shouldIgnore(line) { // # comment, ignore empty lines
+			continue
+		}
+		key, value, err := ReadKeyValuePair(line)
+		if err != nil {
+			errs = append(errs, lineFormatError(ctx.TopologyFile, i, lines[i]))
+			continue
+		}
+		if strings.Contains(key, ServiceConfigSuffix) { // ignore service defs for now
+			continue
+		}
+		res[key] = value
+		lineIdxs[key] = i
+	}
+	// Listed nodes set node_count, otherwise it needs to be there
+	listed, listErrs := listedNodes(ctx, lines, res, lineIdxs)
+	errs = append(errs, listErrs...)
+	nodeCount := len(listed)
+	if _, exists := res[NodeCountPropertyName]; !exists {
+		if listed == nil && len(listErrs) == 0 {
+			errs = append(errs, &ParseError{
+				File:    ctx.TopologyFile,
+				Message: fmt.Sprintf("topology needs to contain a '%s' field", NodeCountPropertyName),
+				Hint:    fmt.Sprintf("add %s = <number of nodes>, or list them with %s", NodeCountPropertyName, NodesPropertyName),
+			})
+		}
+	} else {
+		// Must be a positive integer, matching the listed nodes if any
+		lineIdx := lineIdxs[NodeCountPropertyName]
+		count, err := strconv.Atoi(res[NodeCountPropertyName])
+		if err != nil || count < 1 {
+			errs = append(errs, &ParseError{
+				File:    ctx.TopologyFile,
+				Line:    lineIdx + 1,
+				Column:  valueColumn(lines[lineIdx]),
+				Text:    lines[lineIdx],
+				Message: fmt.Sprintf("'%s' needs to be a positive integer", NodeCountPropertyName),
+			})
+		} else if listed != nil && count != len(listed) {
+			errs = append(errs, &ParseError{
+				File:    ctx.TopologyFile,
+				Line:    lineIdx + 1,
+				Column:  valueColumn(lines[lineIdx]),
+				Text:    lines[lineIdx],
+				Message: fmt.Sprintf("'%s' is %d but %d nodes are listed", NodeCountPropertyName, count, len(listed)),
+				Hint:    fmt.Sprintf("drop %s, listed nodes set it", NodeCountPropertyName),
+			})
+		} else {
+			nodeCount = count
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	inheritConfigFile := ctx.inheritTopologyConfigFile()
+	inheritConfig, err := ReadConfigFile(inheritConfigFile, nil, nil)
+	if err != nil {
+		log.Println(fmt.Sprintf("ingnoring missing inherit topology config: '%s'", inheritConfigFile))
+	} else {
+		log.Println(fmt.Sprintf("inheriting topology config: '%s'", inheritConfigFile))
+	}
+	topologyConfig, err := ReadConfigFile(ctx.topologyConfigFile(), nil, &inheritConfig)
+	if err != nil {
+		return nil, err
+	}
+	// node.<node id>.<key> lines of topology.txt win over the topology config ones
+	nodeData := map[string]string{}
+	for key, value := range res {
+		if strings.HasPrefix(key, NodePropertyPrefix) {
+			nodeData[key] = value
+		}
+	}
+	topologyConfig = NewConfig(nodeData, &topologyConfig)
+	nodes, err := nodesFrom(topologyConfig, listed, nodeCount, ctx.TopologyFile, lines, lineIdxs, ctx.topologyConfigFile())
+	if err != nil {
+		return nil, err
+	}
+
+	return &TopologyMetadata{
+		NodeCount:   nodeCount,
+		NodeNames:   nodeNamesOf(nodes),
+		Nodes:       nodes,
+		NodesListed: listed != nil,
+		Config:      topologyConfig,
+	}, nil
+}
+
+func NewConfig(data map[string]string, parent *Config) Config {
+	res := map[string]string{}
+	// initialize with parent if there
+	if parent != nil {
+		for k, v := range parent.data {
+			res[k] = v
+		}
+	}
+	// override parent
+	for k, v := range data {
+		res[k] = v
+	}
+	return Config{
+		data: res,
+	}
+}
+
+func EmptyConfig() Config {
+	return NewConfig(map[string]string{}, nil)
+}
+
+// config files support templating if you pass in a non nil templateData
+func ReadConfigFile(configFile string, templateData map[string]interface{}, parent *Config) (Config, error) {
+	if _, err := os.Stat(configFile); os.IsNotExist(err) {
+		return EmptyConfig(), nil
+	}
+	configFileBytes, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return EmptyConfig(), err
+	}
+	config, err := ReadConfigString(string(configFileBytes), templateData, parent)
+	if errs, isParseErrors := err.(ParseErrors); isParseErrors {
+		for _, parseErr := range errs {
+			parseErr.File = configFile
+		}
+	} else if err != nil {
+		return config, fmt.Errorf("%s: %w", configFile, err)
+	}
+	return config, err
+}
+
+func ReadConfigString(configFileContents string, templateData map[string]interface{}, parent *Config) (Config, error) {
+	res := map[string]string{}
+	var renderedConfigFileContents = configFileContents
+	var err error
+	if templateData != nil {
+		renderedConfigFileContents, err = RenderTemplateString(configFileContents, templateData)
+		if err != nil {
+			return EmptyConfig(), err
+		}
+	}
+	// Line numbers are the ones of the rendered config, same as the source unless templates add or remove lines
+	var errs ParseErrors
+	for idx, line := range strings.Split(renderedConfigFileContents, "\n") {
+		if shouldIgnore(line) {
+			continue
+		}
+		key, value, err := ReadKeyValuePair(line)
+		if err != nil {
+			errs = append(errs, lineFormatError("", idx, line))
+			continue
+		}
+		res[key] = value
+	}
+	if len(errs) > 0 {
+		return EmptyConfig(), errs
+	}
+	return NewConfig(res, parent), nil
+}
+
+// What the value of a <service>_cfg line says
+type serviceSpec struct {
+	nodeIDs   []int
+	placement *Placement // Instead of node ids
+	ports     []int
+	portNames []string // nil for unnamed ports
+}
+
+// Node ids and ports out of a '1,1,2:2181,2888' spec, or one naming its ports, '1,1,2:client=2181,peer=2888',
+// or one leaving the node ids to a placement strategy, 'spread(3):2181'. Error columns are relative to the spec
+func parseServiceSpec(spec string, nodeCount int) (serviceSpec, ParseErrors) {
+	var errs ParseErrors
+	separatorIdx := strings.Index(spec, InstancePortSeparator)
+	if separatorIdx < 0 {
+		return serviceSpec{}, ParseErrors{{
+			Column:  1,
+			Message: fmt.Sprintf("service spec must have '%s'", InstancePortSeparator),
+			Hint:    fmt.Sprintf("use <node ids>%s<ports>, e.g. 1,2,3%s2181", InstancePortSeparator, InstancePortSeparator),
+		}}
+	}
+	var nodeIDs []int
+	placement, placementErr := parsePlacement(spec[:separatorIdx])
+	if placementErr != nil {
+		errs = append(errs, placementErr)
+	}
+	for _, token := range splitTokens(spec[:separatorIdx], ValueSeparator, 1) {
+		if placement != nil || placementErr != nil {
+			break
+		}
+		tokenNodeIDs, err := parseNodeIDs(token, nodeCount)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		nodeIDs = append(nodeIDs, tokenNodeIDs...)
+	}
+	var ports []int
+	var portNames []string
+	var unnamedToken *valueToken
+	portsColumn := separatorIdx + len(InstancePortSeparator) + 1
+	for _, portToken := range splitTokens(spec[separatorIdx+len(InstancePortSeparator):], ValueSeparator, portsColumn) {
+		token := portToken
+		if strings.Contains(token.text, PortNameSeparator) {
+			nameAndPort := splitTokens(token.text, PortNameSeparator, token.column)
+			if err := checkPortName(nameAndPort[0].text, portNames); err != nil {
+				err.Column = nameAndPort[0].column
+				errs = append(errs, err)
+			}
+			portNames = append(portNames, nameAndPort[0].text)
+			token = nameAndPort[1]
+		} else if unnamedToken == nil {
+			unnamedToken = &token
+		}
+		port, err := strconv.Atoi(token.text)
+		if err != nil {
+			errs = append(errs, &ParseError{
+				Column:  token.column,
+				Message: fmt.Sprintf("port '%s' is not a number", token.text),
+			})
+			continue
+		}
+		if port < MinPort || port > MaxPort {
+			errs = append(errs, &ParseError{
+				Column:  token.column,
+				Message: fmt.Sprintf("port %d is out of range", port),
+				Hint:    fmt.Sprintf("port needs to be between %d and %d, inclusive", MinPort, MaxPort),
+			})
+			continue
+		}
+		ports = append(ports, port)
+	}
+	if portNames != nil && unnamedToken != nil {
+		errs = append(errs, &ParseError{
+			Column:  unnamedToken.column,
+			Message: fmt.Sprintf("port '%s' has no name", unnamedToken.text),
+			Hint:    fmt.Sprintf("name every port or none, e.g. client%s2181", PortNameSeparator),
+		})
+	}
+	return serviceSpec{nodeIDs: nodeIDs, placement: placement, ports: ports, portNames: portNames}, errs
+}
+
+// Node ids one token of a service spec stands for: 2, a range as in 1-5, a repetition as in 3x1 for three
+// instances on node 1, or all and * for one instance per node
+func parseNodeIDs(token valueToken, nodeCount int) ([]int, *ParseError) {
+	var res []int
+	switch {
+	case token.text == AllNodes || token.text == EveryNode:
+		for nodeID := 1; nodeID <= nodeCount; nodeID++ {
+			res = append(res, nodeID)
+		}
+	case strings.Contains(token.text, NodeRangeSeparator):
+		bounds := splitTokens(token.text, NodeRangeSeparator, token.column)
+		if len(bounds) != 2 {
+			return nil, &ParseError{
+				Column:  token.column,
+				Message: fmt.Sprintf("node range '%s' isn't valid", token.text),
+				Hint:    fmt.Sprintf("use <first>%s<last>, e.g. 1%s5", NodeRangeSeparator, NodeRangeSeparator),
+			}
+		}
+		first, err := parseNodeID(bounds[0], nodeCount)
+		if err != nil {
+			return nil, err
+		}
+		last, err := parseNodeID(bounds[1], nodeCount)
+		if err != nil {
+			return nil, err
+		}
+		if first > last {
+			return nil, &ParseError{
+				Column:  token.column,
+				Message: fmt.Sprintf("node range '%s' is empty", token.text),
+				Hint:    "the first node id can't be greater than the last one",
+			}
+		}
+		for nodeID := first; nodeID <= last; nodeID++ {
+			res = append(res, nodeID)
+		}
+	case strings.Contains(token.text, NodeRepeatSeparator):
+		countAndNode := splitTokens(token.text, NodeRepeatSeparator, token.column)
+		count, err := strconv.Atoi(countAndNode[0].text)
+		if err != nil || count < 1 || len(countAndNode) != 2 {
+			return nil, &ParseError{
+				Column:  token.column,
+				Message: fmt.Sprintf("node repetition '%s' isn't valid", token.text),
+				Hint:    fmt.Sprintf("use <instance count>%s<node id>, e.g. 3%s1", NodeRepeatSeparator, NodeRepeatSeparator),
+			}
+		}
+		nodeID, parseErr := parseNodeID(countAndNode[1], nodeCount)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		for idx := 0; idx < count; idx++ {
+			res = append(res, nodeID)
+		}
+	default:
+		nodeID, err := parseNodeID(token, nodeCount)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, nodeID)
+	}
+	return res, nil
+}
+
+func parseNodeID(token valueToken, nodeCount int) (int, *ParseError) {
+	nodeID, err := strconv.Atoi(token.text)
+	if err != nil {
+		return 0, &ParseError{
+			Column:  token.column,
+			Message: fmt.Sprintf("node id '%s' is not a number", token.text),
+		}
+	}
+	if nodeID < 1 || nodeID > nodeCount {
+		return 0, &ParseError{
+			Column:  token.column,
+			Message: fmt.Sprintf("node id %d is out of range", nodeID),
+			Hint:    fmt.Sprintf("node id needs to be between 1 and %d, inclusive", nodeCount),
+		}
+	}
+	return nodeID, nil
+}
+
+var portNameMatcher = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Port names end up as template fields, .instance.named_ports.client
+func checkPortName(name string, previousNames []string) *ParseError {
+	if !portNameMatcher.MatchString(name) {
+		return &ParseError{
+			Message: fmt.Sprintf("port name '%s' isn't valid", name),
+			Hint:    "use letters, digits and _, starting with a letter",
+		}
+	}
+	for _, previousName := range previousNames {
+		if previousName == name {
+			return &ParseError{Message: fmt.Sprintf("port name '%s' is used twice", name)}
+		}
+	}
+	return nil
+}
+
+func parseServiceMetadata(ctx TopologyContext, name, spec string, topologyMetadata TopologyMetadata) (*ServiceMetadata, error) {
+	parsedSpec, errs := parseServiceSpec(spec, topologyMetadata.NodeCount)
+	ports, portNames := parsedSpec.ports, parsedSpec.portNames
+	topologyConfigData := topologyMetadata.Config.dataForRender()
+	inheritConfigFilePath := ctx.inheritServiceConfigFile(name)
+	inheritServiceConfig, err := ReadConfigFile(inheritConfigFilePath, topologyConfigData, &topologyMetadata.Config)
+	if _, err1 := os.Stat(inheritConfigFilePath); err != nil || os.IsNotExist(err1) {
+		log.Println(fmt.Sprintf("ignoring missing inherit service config: '%s'", inheritConfigFilePath))
+	} else {
+		log.Println(fmt.Sprintf("inheriting '%s' from config: '%s'", name, inheritConfigFilePath))
+	}
+
+	configFilePath := ctx.serviceConfigFilePath(name)
+	serviceConfig, err := ReadConfigFile(configFilePath, topologyConfigData, &inheritServiceConfig)
+	if configErrs, isParseErrors := err.(ParseErrors); isParseErrors {
+		return nil, append(errs, configErrs...)
+	} else if err != nil {
+		return nil, err
+	}
+	// port names in topology.txt win over the service config ones
+	if configNames := serviceConfig.GetString(PortNamesPropertyName, ""); portNames == nil && configNames != "" && len(errs) == 0 {
+		for _, token := range splitTokens(configNames, ValueSeparator, 1) {
+			if err := checkPortName(token.text, portNames); err != nil {
+				err.Message = fmt.Sprintf("%s: %s", PortNamesPropertyName, err.Message)
+				errs = append(errs, err)
+			}
+			portNames = append(portNames, token.text)
+		}
+		if len(portNames) != len(ports) {
+			errs = append(errs, &ParseError{
+				Message: fmt.Sprintf("%s in its service config has %d names for %d ports", PortNamesPropertyName, len(portNames), len(ports)),
+				Hint:    "name every port, in order",
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	// service config w/o topology data, strictly for JSON rendering. DO NOT USE for rendering
+	inheritRawConfig, err := ReadConfigFile(inheritConfigFilePath, topologyConfigData, nil)
+	if err != nil {
+		return nil, err
+	}
+	rawConfig, err := ReadConfigFile(configFilePath, topologyConfigData, &inheritRawConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceMetadata{
+		Name:      name,
+		NodeIDs:   parsedSpec.nodeIDs,
+		Placement: parsedSpec.placement,
+		Ports:     ports,
+		PortNames: portNames,
+		Config:    serviceConfig,
+		RawConfig: rawConfig,
+	}, nil
+}
+
+func ServiceMetadataFromLines(ctx TopologyContext, lines []string, topologyMetadata TopologyMetadata, parse bool) ([]ServiceMetadata, error) {
+	var metas []ServiceMetadata
+	var errs ParseErrors
+	serviceLines := map[string]int{}
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if shouldIgnore(line) { // # comment, ignore empty lines
+			continue
+		}
+		key, serviceSpec, err := ReadKeyValuePair(line)
+		if err != nil {
+			errs = append(errs, lineFormatError(ctx.TopologyFile, i, lines[i]))
+			continue
+		}
+		if !strings.Contains(key, ServiceConfigSuffix) { // ignore all but service defs
+			continue
+		}
+		serviceName := strings.ReplaceAll(key, ServiceConfigSuffix, "")
+		if parse {
+			if previousLine, exists := serviceLines[serviceName]; exists {
+				errs = append(errs, &ParseError{
+					File:    ctx.TopologyFile,
+					Line:    i + 1,
+					Text:    lines[i],
+					Message: fmt.Sprintf("duplicate service key '%s'", key),
+					Hint:    fmt.Sprintf("already defined on line %d", previousLine),
+				})
+				continue
+			}
+			serviceLines[serviceName] = i + 1
+			if isReservedServiceName(serviceName) {
+				errs = append(errs, &ParseError{
+					File:    ctx.TopologyFile,
+					Line:    i + 1,
+					Text:    lines[i],
+					Message: fmt.Sprintf("service name '%s' is reserved", serviceName),
+					Hint:    fmt.Sprintf("rename the service, these are taken: %s", strings.Join(ReservedServiceNames, ", ")),
+				})
+				continue
+			}
+			meta, err := parseServiceMetadata(ctx, serviceName, serviceSpec, topologyMetadata)
+			if serviceErrs, isParseErrors := err.(ParseErrors); isParseErrors {
+				errs = append(errs, serviceErrs.at(ctx.TopologyFile, i+1, valueColumn(lines[i]), lines[i])...)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			meta.Line = i + 1
+			metas = append(metas, *meta)
+		}  else {
+			meta := &ServiceMetadata{
+				Name:      serviceName,
+				NodeIDs:   nil,
+				Ports:     nil,
+				Config:    NewConfig(map[string]string{}, nil),
+				RawConfig: NewConfig(map[string]string{}, nil),
+			}
+			metas = append(metas, *meta)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return metas, nil
+}
+
+// Services named like a root key of .topology would overwrite it, or get overwritten
+func isReservedServiceName(name string) bool {
+	for _, reserved := range ReservedServiceNames {
+		if name == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+func lineFormatError(file string, lineIdx int, line string) *ParseError {
+	return &ParseError{
+		File:    file,
+		Line:    lineIdx + 1,
+		Text:    line,
+		Message: "incorrect line format",
+		Hint:    fmt.Sprintf("use key %s value", KeyValueSeparator),
+	}
+}
+
+func shouldIgnore(line string) bool {
+	return strings.Index(line, "#") == 0 || strings.TrimSpace(line) == ""
+}
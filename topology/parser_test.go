@@ -0,0 +1,147 @@
+package topology
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTopologyMetadataFromLines(t *testing.T) {
+	topologyMetadata, err := TopologyMetadataFromLines(NewTopologyContext("testdata"), strings.Split(TopologyString, "\n"))
+	handleTestingError(err, t)
+	MustBeInt(2, topologyMetadata.NodeCount, "node_count", t)
+}
+
+func TestServiceMetadataFromLines(t *testing.T) {
+	topologyMetadata, err := TopologyMetadataFromLines(NewTopologyContext("testdata"), strings.Split(TopologyString, "\n"))
+	handleTestingError(err, t)
+	serviceMetadataList, err := ServiceMetadataFromLines(NewTopologyContext("testdata"), strings.Split(TopologyString, "\n"), *topologyMetadata, true)
+	MustBeInt(1, len(serviceMetadataList), "service def count", t)
+	serviceMetadata := serviceMetadataList[0]
+	MustBeInt(3, len(serviceMetadata.NodeIDs), "node id count", t)
+	MustBeInt(3, len(serviceMetadata.Ports), "port count", t)
+	MustBeInt(1, serviceMetadata.NodeIDs[0], "1st node id", t)
+	MustBeInt(1, serviceMetadata.NodeIDs[1], "2nd node id", t)
+	MustBeInt(2, serviceMetadata.NodeIDs[2], "3rd node id", t)
+	MustBeInt(2181, serviceMetadata.Ports[0], "1st port", t)
+	MustBeInt(2888, serviceMetadata.Ports[1], "2nd port", t)
+	MustBeInt(3888, serviceMetadata.Ports[2], "3rd port", t)
+}
+
+func TestReadConfigContent(t *testing.T) {
+	topologyConfig, err := ReadConfigString(TopologyConfig, map[string]interface{}{}, nil)
+	handleTestingError(err, t)
+	serviceConfig, err := ReadConfigString(ServiceConfig, topologyConfig.dataForRender(), &topologyConfig)
+	MustBeString("/home/app/zookeeper", serviceConfig.GetString("runtime_folder", ""), "runtime_folder config", t)
+}
+
+func MustBeInt(expected, current int, what string, t *testing.T) {
+	if current != expected {
+		t.Errorf("%s is '%d' but should be '%d'", what, current, expected)
+	}
+}
+
+func MustBeString(expected, current string, what string, t *testing.T) {
+	if current != expected {
+		t.Errorf("%s is '%s' but should be '%s'", what, current, expected)
+	}
+}
+
+func handleTestingError(err error, t *testing.T) {
+	if err != nil {
+		t.Errorf("unable to read topology metadata, err: %s", err)
+	}
+}
+
+const TopologyString = `# Ignore comments, extra space and empty lines
+
+node_count     = 2 
+zookeeper_cfg  = 1,1, 2: 2181, 2888,3888  
+`
+const TopologyConfig = `# Ignore comments, extra space and empty lines
+
+stack          = app 
+runtime_folder = /home/app
+app_user       = app
+`
+
+const ServiceConfig = `# Ignore comments, extra space and empty lines
+runtime_folder = {{ .topology.config.runtime_folder }}/zookeeper
+stack          = kafka
+`
+
+func TestParseErrors(t *testing.T) {
+	ctx := NewTopologyContext("testdata")
+	lines := strings.Split(BrokenTopologyString, "\n")
+	topologyMetadata, err := TopologyMetadataFromLines(ctx, lines)
+	handleTestingError(err, t)
+	_, err = ServiceMetadataFromLines(ctx, lines, *topologyMetadata, true)
+	errs, isParseErrors := err.(ParseErrors)
+	if !isParseErrors {
+		t.Fatalf("should fail with parse errors, err: %v", err)
+	}
+	MustBeInt(3, len(errs), "parse error count", t)
+	MustBeString("testdata/topology.txt:3:19: node id 3 is out of range: 'kafka_cfg    = 1, 3:x' "+
+		"(node id needs to be between 1 and 2, inclusive)", errs[0].Error(), "1st error", t)
+	MustBeInt(3, errs[1].Line, "2nd error line", t)
+	MustBeInt(21, errs[1].Column, "2nd error column", t)
+	MustBeString("port 'x' is not a number", errs[1].Message, "2nd error message", t)
+	MustBeInt(4, errs[2].Line, "3rd error line", t)
+}
+
+func TestParseNamedPorts(t *testing.T) {
+	spec, errs := parseServiceSpec("1,2:client=2181, peer = 2888", 2)
+	MustBeInt(0, len(errs), "parse error count", t)
+	MustBeString("[2181 2888] [client peer]", fmt.Sprint(spec.ports, spec.portNames), "ports and names", t)
+
+	_, errs = parseServiceSpec("1:client=2181,2888,client=3888,9-x=1", 1)
+	MustBeInt(3, len(errs), "parse error count", t)
+	MustBeString("port name 'client' is used twice", errs[0].Message, "duplicate name", t)
+	MustBeInt(20, errs[0].Column, "duplicate name column", t)
+	MustBeString("port name '9-x' isn't valid", errs[1].Message, "bad name", t)
+	MustBeInt(32, errs[1].Column, "bad name column", t)
+	MustBeString("port '2888' has no name", errs[2].Message, "unnamed port", t)
+	MustBeInt(15, errs[2].Column, "unnamed port column", t)
+}
+
+func TestParseNodeShorthands(t *testing.T) {
+	for spec, expected := range map[string]string{
+		"1-3:80":       "[1 2 3]",
+		"3x1, 2:80":    "[1 1 1 2]",
+		"all:80":       "[1 2 3 4]",
+		"*:80":         "[1 2 3 4]",
+		"2-2,1,2x4:80": "[2 1 4 4]",
+	} {
+		parsedSpec, errs := parseServiceSpec(spec, 4)
+		MustBeInt(0, len(errs), spec+" parse error count", t)
+		MustBeString(expected, fmt.Sprint(parsedSpec.nodeIDs), spec, t)
+	}
+	for spec, expected := range map[string]string{
+		"1-5:80":   "node id 5 is out of range",
+		"3-1:80":   "node range '3-1' is empty",
+		"1-2-3:80": "node range '1-2-3' isn't valid",
+		"0x1:80":   "node repetition '0x1' isn't valid",
+		"2xa:80":   "node id 'a' is not a number",
+		"al:80":    "node id 'al' is not a number",
+	} {
+		_, errs := parseServiceSpec(spec, 4)
+		MustBeInt(1, len(errs), spec+" parse error count", t)
+		if len(errs) > 0 {
+			MustBeString(expected, errs[0].Message, spec, t)
+		}
+	}
+}
+
+func TestParseErrorsTopologyMetadata(t *testing.T) {
+	_, err := TopologyMetadataFromLines(NewTopologyContext("testdata"),
+		[]string{"node_count = two", "zookeeper_cfg 1,2:2181"})
+	MustBeString("testdata/topology.txt:2: incorrect line format: 'zookeeper_cfg 1,2:2181' (use key = value)\n"+
+		"testdata/topology.txt:1:14: 'node_count' needs to be a positive integer: 'node_count = two'",
+		err.Error(), "topology metadata errors", t)
+}
+
+const BrokenTopologyString = `node_count     = 2
+# Everything below is broken
+kafka_cfg    = 1, 3:x
+connect_cfg  = 1,2
+`
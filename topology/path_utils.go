@@ -0,0 +1,334 @@
+package topology
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+)
+
+const TopologyFolder = "."                   // Where everything gets picked up from
+const TopologyFile = "topology.txt"          // Definition file
+const TopologyConfigFile = "topology.config" // Config file
+const ServiceConfigFile = "service.config"   // Service config file
+const ServicesFolder = "services"            // Where service folders live
+const DeployFolder = "deploy"                // Where everything ends up, eventually
+const BinFolder = "bin"                      // Where shell scripts live
+const InheritRootFolder = "topology"         // Special folder for topology inheritance pack
+const VendorFolder = ".lazy_vendor"          // Where inherited packs live
+const TemplateExt = ".tmpl"                  // Everything with this extension gets rendered
+const DefaultFileMode = os.FileMode(0644)    // Rendered files have these access rights
+const DefaultDirMode = os.FileMode(0755)     // Rendered folders have these access rights
+const ScriptFileMode = os.FileMode(0755)     // Generated scripts have these access rights
+
+// Working paths of one topology. Nothing assumes the process runs in the topology folder, so several
+// topologies can be built and rendered from the same process
+type TopologyContext struct {
+	TopologyFile string // Definition file, topology.config and bin are picked up next to it
+	ServicesDir  string // Where service folders live
+	DeployDir    string // Where everything ends up, eventually
+	VendorDir    string // Where inherited packs live
+	LockFile     string // Ports handed out by earlier renders, empty for no lock file
+	Offline      bool   // Never git fetch, only use the packs already in VendorDir
+	dirCache     *DirCache
+	fileModes    map[string]os.FileMode // Modes of the files being rendered, applied once they're all written
+}
+
+// Default layout for a topology living in topologyFolder
+func NewTopologyContext(topologyFolder string) TopologyContext {
+	return TopologyContext{
+		TopologyFile: path.Join(topologyFolder, TopologyFile),
+		ServicesDir:  path.Join(topologyFolder, ServicesFolder),
+		DeployDir:    path.Join(topologyFolder, DeployFolder),
+		VendorDir:    path.Join(topologyFolder, VendorFolder),
+		LockFile:     path.Join(topologyFolder, LockFile),
+	}
+}
+
+func DefaultTopologyContext() TopologyContext {
+	return NewTopologyContext(TopologyFolder)
+}
+
+func (ctx TopologyContext) topologyDir() string {
+	return path.Dir(ctx.TopologyFile)
+}
+
+func (ctx TopologyContext) topologyConfigFile() string {
+	return path.Join(ctx.topologyDir(), TopologyConfigFile)
+}
+
+func (ctx TopologyContext) serviceConfigFilePath(serviceName string) string {
+	return path.Join(ctx.serviceDir(serviceName), ServiceConfigFile)
+}
+
+func (ctx TopologyContext) serviceDir(serviceName string) string {
+	return path.Join(ctx.ServicesDir, serviceName)
+}
+
+func (ctx TopologyContext) deployFilePath(filePath string) string {
+	return path.Join(ctx.DeployDir, filePath)
+}
+
+func (ctx TopologyContext) inheritRootDir() string {
+	return path.Join(ctx.VendorDir, InheritRootFolder)
+}
+
+func (ctx TopologyContext) inheritServiceDir(serviceName string) string {
+	return path.Join(ctx.VendorDir, serviceName)
+}
+
+func (ctx TopologyContext) inheritTopologyConfigFile() string {
+	return path.Join(ctx.inheritRootDir(), TopologyConfigFile)
+}
+
+func (ctx TopologyContext) inheritServiceConfigFile(serviceName string) string {
+	return path.Join(ctx.inheritServiceDir(serviceName), ServiceConfigFile)
+}
+
+func (ctx TopologyContext) stackFilePath(stackName string) string {
+	return path.Join(ctx.DeployDir, DefaultSwarmDeployFolder, fmt.Sprintf("%s.yml", stackName))
+}
+
+func (ctx TopologyContext) swarmNodeLabelsFilePath() string {
+	return path.Join(ctx.DeployDir, DefaultSwarmDeployFolder, SwarmNodeLabelsFile)
+}
+
+func (ctx TopologyContext) composeFilePath() string {
+	return path.Join(ctx.DeployDir, ComposeDeployFolder, ComposeFile)
+}
+
+func (ctx TopologyContext) k8sFilePath(serviceName string) string {
+	return path.Join(ctx.DeployDir, K8sDeployFolder, fmt.Sprintf("%s.yml", serviceName))
+}
+
+func (ctx TopologyContext) ansibleInventoryFilePath() string {
+	return path.Join(ctx.DeployDir, AnsibleDeployFolder, AnsibleInventoryFile)
+}
+
+func (ctx TopologyContext) terraformVarsFilePath() string {
+	return path.Join(ctx.DeployDir, TerraformDeployFolder, TerraformVarsFile)
+}
+
+func (ctx TopologyContext) deployOrderFilePath() string {
+	return path.Join(ctx.DeployDir, DeployOrderFile)
+}
+
+func (ctx TopologyContext) topologyJsonFile() string {
+	return path.Join(ctx.DeployDir, "topology.json")
+}
+
+func (ctx TopologyContext) rootInheritBinFolder() string {
+	return path.Join(ctx.inheritRootDir(), BinFolder)
+}
+
+func (ctx TopologyContext) binDir() string {
+	return path.Join(ctx.topologyDir(), BinFolder)
+}
+
+func MkDirs(dirPath string) error {
+	err := os.MkdirAll(dirPath, DefaultDirMode)
+	if err != nil {
+		return fmt.Errorf("mkdirs failed: %s, %w", dirPath, err)
+	}
+	return nil
+}
+
+// Folders already created during a render, so appending to a file doesn't stat its way up every time
+type DirCache struct {
+	dirs map[string]bool
+}
+
+func NewDirCache() *DirCache {
+	return &DirCache{dirs: map[string]bool{}}
+}
+
+// Same as MkDirs, only once per path. A nil cache always goes to MkDirs
+func (dirCache *DirCache) MkDirs(dirPath string) error {
+	if dirCache == nil {
+		return MkDirs(dirPath)
+	}
+	if dirCache.dirs[dirPath] {
+		return nil
+	}
+	err := MkDirs(dirPath)
+	if err != nil {
+		return err
+	}
+	dirCache.dirs[dirPath] = true
+	return nil
+}
+
+// Same as cp -R: dest ends up a copy of source, file modes and symlinks included
+func CopyDir(source string, dest string) error {
+	err := filepath.Walk(source, func(sourcePath string, handle os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(source, sourcePath)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(dest, relPath)
+		switch {
+		case handle.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(sourcePath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, destPath)
+		case handle.IsDir():
+			err := os.MkdirAll(destPath, handle.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			// MkdirAll leaves existing folders alone and is subject to umask
+			return os.Chmod(destPath, handle.Mode().Perm())
+		default:
+			return copyFile(sourcePath, destPath, handle.Mode().Perm())
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("copy dirs failed: %s -> %s, %w", source, dest, err)
+	}
+	return nil
+}
+
+func copyFile(source string, dest string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close() // ignore error; Copy error takes precedence
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dest, mode)
+}
+
+func readTextFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	b, err := ioutil.ReadAll(file)
+	return string(b), err
+}
+
+func (ctx TopologyContext) appendToFile(filePath string, content string) error {
+	return ctx.appendToFileWithMode(filePath, content, DefaultFileMode)
+}
+
+// mode only applies if the file gets created, appending keeps the mode it was created with. While rendering, files
+// stay writable and get their mode from applyFileModes, once everything is written
+func (ctx TopologyContext) appendToFileWithMode(filePath string, content string, mode os.FileMode) error {
+	// Make the dirs up to the file
+	err := ctx.dirCache.MkDirs(path.Dir(filePath))
+	if err != nil {
+		return err
+	}
+	// If the file doesn't exist, create it, or append to the file
+	created := true
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, DefaultFileMode)
+	if os.IsExist(err) {
+		created = false
+		f, err = os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, DefaultFileMode)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(content)); err != nil {
+		err1 := f.Close() // ignore error; Write error takes precedence
+		if err1 != nil {
+			return err1
+		}
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if !created {
+		return nil
+	}
+	if ctx.fileModes != nil {
+		ctx.fileModes[filePath] = mode
+		return nil
+	}
+	// Creating is subject to umask, files get exactly the mode they're meant to
+	return os.Chmod(filePath, mode)
+}
+
+// Gives the files written since fileModes was set their mode
+func (ctx TopologyContext) applyFileModes() error {
+	for filePath, mode := range ctx.fileModes {
+		if err := os.Chmod(filePath, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type GitCache struct {
+	cache map[string]string
+}
+
+func NewGitCache() *GitCache {
+	return &GitCache{cache: map[string]string{}}
+}
+
+func (gitCache GitCache) cleanup() {
+	for _, tempFolder := range gitCache.cache {
+		err := os.RemoveAll(tempFolder)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("git temp folder cleanup failed: %v", err))
+		}
+	}
+}
+
+func (gitCache GitCache) fetch(sourceSpec string, destFolder string) error {
+	// if already there, don't clone
+	var pathInfo, err = os.Stat(destFolder)
+	// We continue only if it's not already there
+	if !os.IsNotExist(err) && pathInfo.IsDir() {
+		return nil
+	}
+	sourceDef := parseSourceDef(sourceSpec)
+	repoKey := fmt.Sprintf("%s_%s", sourceDef.gitUrl, sourceDef.branch)
+	var tempDir = gitCache.cache[repoKey]
+	if tempDir == "" {
+		tempDir, err = ioutil.TempDir("", "lazy")
+		if err != nil {
+			return err
+		}
+		cmd := exec.Command("git", "clone", "-b", sourceDef.branch, "--single-branch", "--depth", "1", sourceDef.gitUrl, tempDir)
+		log.Println(fmt.Sprintf("cloning for '%s'... %v", sourceDef.subFolder, sourceDef.gitUrl))
+		err = cmd.Run()
+		if err != nil {
+			return fmt.Errorf("git clone failed: %s, %s, %w", sourceDef.gitUrl, sourceDef.branch, err)
+		}
+		// cleanup first
+		err = os.RemoveAll(destFolder)
+		if err != nil {
+			return err
+		}
+		err = MkDirs(path.Dir(destFolder))
+		if err != nil {
+			return err
+		}
+		gitCache.cache[repoKey] = tempDir
+	}
+	err = CopyDir(path.Join(tempDir, sourceDef.subFolder), destFolder)
+	return err
+}
@@ -0,0 +1,112 @@
+package topology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyDir(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "lazy_test")
+	handleTestingError(err, t)
+	defer os.RemoveAll(tempDir)
+	source := path.Join(tempDir, "source")
+	ctx := TopologyContext{}
+	handleTestingError(ctx.appendToFile(path.Join(source, "bin", "run.sh"), "#!/usr/bin/env bash\n"), t)
+	handleTestingError(os.Chmod(path.Join(source, "bin", "run.sh"), 0755), t)
+	handleTestingError(os.Symlink("bin/run.sh", path.Join(source, "run.sh")), t)
+
+	dest := path.Join(tempDir, "dest")
+	handleTestingError(CopyDir(source, dest), t)
+
+	info, err := os.Stat(path.Join(dest, "bin", "run.sh"))
+	handleTestingError(err, t)
+	MustBeString("-rwxr-xr-x", info.Mode().String(), "copied file mode", t)
+	target, err := os.Readlink(path.Join(dest, "run.sh"))
+	handleTestingError(err, t)
+	MustBeString("bin/run.sh", target, "copied symlink target", t)
+}
+
+// A pack of 20 folders with 25 files each, the size of the bench topology render
+func benchPack(b *testing.B, root string) []string {
+	var filePaths []string
+	ctx := TopologyContext{}
+	for dirIdx := 0; dirIdx < 20; dirIdx++ {
+		for fileIdx := 0; fileIdx < 25; fileIdx++ {
+			filePath := path.Join(root, fmt.Sprintf("dir%02d", dirIdx), fmt.Sprintf("file%02d.cfg", fileIdx))
+			if err := ctx.appendToFile(filePath, "key = value\n"); err != nil {
+				b.Fatal(err)
+			}
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	return filePaths
+}
+
+// Folders made before every appended file: mkdir -p as it used to be, MkDirs, and MkDirs through the DirCache
+func BenchmarkMkDirs(b *testing.B) {
+	tempDir, err := ioutil.TempDir("", "lazy_bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	filePaths := benchPack(b, path.Join(tempDir, "pack"))
+	for _, bench := range []struct {
+		name  string
+		mkDir func(dirCache *DirCache, dirPath string) error
+	}{
+		{"mkdir -p", func(dirCache *DirCache, dirPath string) error { return exec.Command("mkdir", "-p", dirPath).Run() }},
+		{"MkDirs", func(dirCache *DirCache, dirPath string) error { return MkDirs(dirPath) }},
+		{"DirCache", func(dirCache *DirCache, dirPath string) error { return dirCache.MkDirs(dirPath) }},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dest := path.Join(tempDir, fmt.Sprintf("dest%d", i))
+				dirCache := NewDirCache()
+				for _, filePath := range filePaths {
+					rel, _ := filepath.Rel(tempDir, filePath)
+					if err := bench.mkDir(dirCache, path.Dir(path.Join(dest, rel))); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StopTimer()
+				_ = os.RemoveAll(dest)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// Copying a pack: cp -R as it used to be, and CopyDir
+func BenchmarkCopyDir(b *testing.B) {
+	tempDir, err := ioutil.TempDir("", "lazy_bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	source := path.Join(tempDir, "pack")
+	benchPack(b, source)
+	for _, bench := range []struct {
+		name string
+		copy func(source string, dest string) error
+	}{
+		{"cp -R", func(source string, dest string) error { return exec.Command("cp", "-R", source, dest).Run() }},
+		{"CopyDir", CopyDir},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dest := path.Join(tempDir, fmt.Sprintf("dest%d", i))
+				if err := bench.copy(source, dest); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				_ = os.RemoveAll(dest)
+				b.StartTimer()
+			}
+		})
+	}
+}
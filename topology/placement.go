@@ -0,0 +1,201 @@
+package topology
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const SpreadPlacement = "spread"                 // spread(3): 3 instances on the least busy nodes, one per node as long as there are nodes left
+const BinpackPlacement = "binpack"               // binpack(3): 3 instances on as few nodes as possible, the busiest ones first
+const AntiAffinityPropertyName = "anti_affinity" // anti_affinity = zookeeper,kafka in service.config keeps placed instances off their nodes
+const MaxPerNodePropertyName = "max_per_node"    // max_per_node = 1 in service.config caps placed instances per node
+
+// Node ids left to a placement strategy, as in spread(3)
+type Placement struct {
+	Strategy string
+	Count    int
+}
+
+func (placement Placement) String() string {
+	return fmt.Sprintf("%s(%d)", placement.Strategy, placement.Count)
+}
+
+var placementMatcher = regexp.MustCompile(`^\s*(\w+)\s*\(\s*(\d+)\s*\)\s*$`)
+
+// Placement out of the node ids part of a service spec, nil when it's node ids
+func parsePlacement(nodeSpec string) (*Placement, *ParseError) {
+	trimmed := strings.TrimSpace(nodeSpec)
+	if !strings.HasPrefix(trimmed, SpreadPlacement) && !strings.HasPrefix(trimmed, BinpackPlacement) {
+		return nil, nil
+	}
+	invalid := &ParseError{
+		Column:  len(nodeSpec) - len(strings.TrimLeft(nodeSpec, " \t")) + 1,
+		Message: fmt.Sprintf("placement '%s' isn't valid", trimmed),
+		Hint:    fmt.Sprintf("use %s(<instance count>) or %s(<instance count>)", SpreadPlacement, BinpackPlacement),
+	}
+	match := placementMatcher.FindStringSubmatch(nodeSpec)
+	if match == nil || (match[1] != SpreadPlacement && match[1] != BinpackPlacement) {
+		return nil, invalid
+	}
+	count, err := strconv.Atoi(match[2])
+	if err != nil || count < 1 {
+		return nil, invalid
+	}
+	return &Placement{Strategy: match[1], Count: count}, nil
+}
+
+// Fills in the node ids of the services using a placement strategy, in topology order, once the explicitly
+// placed services took their nodes. Services they have anti affinity with need to be placed already.
+// Explicitly placed services get their node_labels checked
+func placeServices(ctx TopologyContext, services []ServiceMetadata, nodes []NodeDef) error {
+	load := make([]int, len(nodes)+1) // node id -> instances on it
+	placed := map[string][]int{}
+	var errs ParseErrors
+	for _, service := range services {
+		if service.Placement == nil {
+			for _, nodeID := range service.NodeIDs {
+				load[nodeID]++
+			}
+			placed[service.Name] = service.NodeIDs
+			if err := checkNodeLabels(service, nodes); err != nil {
+				errs = append(errs, ParseErrors{err}.at(ctx.TopologyFile, service.Line, 0, "")...)
+			}
+		}
+	}
+	for idx := range services {
+		service := &services[idx]
+		if service.Placement == nil {
+			continue
+		}
+		nodeIDs, err := place(*service, load, placed, services, nodes)
+		if err != nil {
+			errs = append(errs, ParseErrors{err}.at(ctx.TopologyFile, service.Line, 0, "")...)
+			continue
+		}
+		for _, nodeID := range nodeIDs {
+			load[nodeID]++
+		}
+		service.NodeIDs = nodeIDs
+		placed[service.Name] = nodeIDs
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Node labels a service asks for in its node_labels config
+func nodeLabelsOf(service ServiceMetadata) (map[string]string, *ParseError) {
+	labels, err := parseLabels(service.Config.GetString(NodeLabelsConstraintName, ""))
+	if err != nil {
+		err.Column = 0
+		err.Message = fmt.Sprintf("%s: %s", NodeLabelsConstraintName, err.Message)
+	}
+	return labels, err
+}
+
+func checkNodeLabels(service ServiceMetadata, nodes []NodeDef) *ParseError {
+	labels, err := nodeLabelsOf(service)
+	if err != nil {
+		return err
+	}
+	for _, nodeID := range service.NodeIDs {
+		if !nodes[nodeID-1].hasLabels(labels) {
+			return &ParseError{
+				Message: fmt.Sprintf("node %d (%s) lacks the %s of '%s' (%s)", nodeID, nodes[nodeID-1].Name,
+					NodeLabelsConstraintName, service.Name, service.Config.GetString(NodeLabelsConstraintName, "")),
+				Hint: fmt.Sprintf("label it with %s%d.%s or pick another node", NodePropertyPrefix, nodeID, NodeLabelsPropertyName),
+			}
+		}
+	}
+	return nil
+}
+
+func place(service ServiceMetadata, load []int, placed map[string][]int, services []ServiceMetadata,
+	nodes []NodeDef) ([]int, *ParseError) {
+
+	labels, err := nodeLabelsOf(service)
+	if err != nil {
+		return nil, err
+	}
+	avoided := map[int]bool{}
+	for _, node := range nodes {
+		avoided[node.ID] = !node.hasLabels(labels)
+	}
+	antiAffinity := service.Config.GetString(AntiAffinityPropertyName, "")
+	for _, token := range splitTokens(antiAffinity, ValueSeparator, 1) {
+		if token.text == "" {
+			continue
+		}
+		nodeIDs, isPlaced := placed[token.text]
+		if !isPlaced {
+			message := fmt.Sprintf("%s: service '%s' doesn't exist", AntiAffinityPropertyName, token.text)
+			for _, other := range services {
+				if other.Name == token.text {
+					message = fmt.Sprintf("%s: service '%s' isn't placed yet", AntiAffinityPropertyName, token.text)
+				}
+			}
+			return nil, &ParseError{
+				Message: message,
+				Hint:    "services to stay away from need explicit node ids or to come first in the topology",
+			}
+		}
+		for _, nodeID := range nodeIDs {
+			avoided[nodeID] = true
+		}
+	}
+	maxPerNode, atoiErr := strconv.Atoi(service.Config.GetString(MaxPerNodePropertyName, "0"))
+	if atoiErr != nil || maxPerNode < 0 {
+		return nil, &ParseError{Message: fmt.Sprintf("%s needs to be a positive number", MaxPerNodePropertyName)}
+	}
+
+	own := make([]int, len(load)) // node id -> instances of this service on it
+	var res []int
+	// load is only this function's business while placing, the caller updates it
+	defer func() {
+		for _, nodeID := range res {
+			load[nodeID]--
+		}
+	}()
+	for len(res) < service.Placement.Count {
+		best := 0
+		for nodeID := 1; nodeID < len(load); nodeID++ {
+			if avoided[nodeID] || maxPerNode > 0 && own[nodeID] >= maxPerNode {
+				continue
+			}
+			if best == 0 || better(service.Placement.Strategy, nodeID, best, own, load) {
+				best = nodeID
+			}
+		}
+		if best == 0 {
+			return nil, &ParseError{
+				Message: fmt.Sprintf("%s only fits %d instances of '%s' on %d nodes", service.Placement, len(res),
+					service.Name, len(load)-1),
+				Hint: fmt.Sprintf("add nodes, lower the instance count or relax %s (%s), %s (%s) and %s (%s)",
+					MaxPerNodePropertyName, service.Config.GetString(MaxPerNodePropertyName, "none"),
+					AntiAffinityPropertyName, service.Config.GetString(AntiAffinityPropertyName, "none"),
+					NodeLabelsConstraintName, service.Config.GetString(NodeLabelsConstraintName, "none")),
+			}
+		}
+		own[best]++
+		load[best]++
+		res = append(res, best)
+	}
+	sorted := append([]int{}, res...)
+	sort.Ints(sorted)
+	return sorted, nil
+}
+
+// Whether nodeID beats best, lower node ids win ties as nodes are visited in order
+func better(strategy string, nodeID int, best int, own []int, load []int) bool {
+	if strategy == BinpackPlacement {
+		return load[nodeID] > load[best]
+	}
+	if own[nodeID] != own[best] {
+		return own[nodeID] < own[best]
+	}
+	return load[nodeID] < load[best]
+}
@@ -0,0 +1,69 @@
+package topology
+
+import (
+	"fmt"
+	"testing"
+)
+
+func nodeIDsOf(topology *Topology, serviceName string, t *testing.T) string {
+	service, exists := topology.Service(serviceName)
+	if !exists {
+		t.Fatalf("service '%s' is missing", serviceName)
+	}
+	var nodes []string
+	for _, instance := range service.Instances {
+		nodes = append(nodes, instance.Node)
+	}
+	return fmt.Sprint(nodes)
+}
+
+func TestSpreadPlacement(t *testing.T) {
+	topology, err := BuildTopologyFromString(NewTopologyContext("testdata"),
+		"node_count = 3\nkafka_cfg = spread(4):9092\nzookeeper_cfg = 1:2181")
+	handleTestingError(err, t)
+	MustBeString("[dev-node01 dev-node02 dev-node02 dev-node03]", nodeIDsOf(topology, "kafka", t), "kafka nodes", t)
+}
+
+func TestBinpackPlacement(t *testing.T) {
+	topology, err := BuildTopologyFromString(NewTopologyContext("testdata"),
+		"node_count = 3\nkafka_cfg = binpack(2):9092\nzookeeper_cfg = 2:2181")
+	handleTestingError(err, t)
+	MustBeString("[dev-node02 dev-node02]", nodeIDsOf(topology, "kafka", t), "kafka nodes", t)
+}
+
+func TestPlacementConstraints(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{
+		"services/kafka/service.config": "anti_affinity = zookeeper\nmax_per_node = 2",
+	}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 3\nzookeeper_cfg = 1:2181\nkafka_cfg = binpack(4):9092", t)
+	MustBeString("[dev-node02 dev-node02 dev-node03 dev-node03]", nodeIDsOf(topology, "kafka", t), "kafka nodes", t)
+
+	_, err := BuildTopologyFromString(ctx, "node_count = 3\nzookeeper_cfg = 1:2181\nkafka_cfg = spread(5):9092")
+	MustBeString(fmt.Sprintf("%s:3: spread(5) only fits 4 instances of 'kafka' on 3 nodes "+
+		"(add nodes, lower the instance count or relax max_per_node (2), anti_affinity (zookeeper) and node_labels (none))", ctx.TopologyFile),
+		fmt.Sprint(err), "error", t)
+
+	_, err = BuildTopologyFromString(ctx, "node_count = 3\nkafka_cfg = spread(2):9092\nzookeeper_cfg = spread(1):2181")
+	MustBeString(fmt.Sprintf("%s:2: anti_affinity: service 'zookeeper' isn't placed yet "+
+		"(services to stay away from need explicit node ids or to come first in the topology)", ctx.TopologyFile),
+		fmt.Sprint(err), "error", t)
+}
+
+func TestParsePlacement(t *testing.T) {
+	placement, err := parsePlacement(" spread( 3 ) ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	MustBeString("spread(3)", placement.String(), "placement", t)
+	placement, err = parsePlacement("1,2")
+	if placement != nil || err != nil {
+		t.Errorf("node ids should not be a placement")
+	}
+	for _, spec := range []string{"spread(x)", "spread(0)", "binpack", "spreadx(2)"} {
+		if _, err := parsePlacement(spec); err == nil {
+			t.Errorf("'%s' should not parse", spec)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package topology
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const FixedPortsPropertyName = "fixed_ports"       // fixed_ports = true in service.config fails the build rather than shifting ports
+const ReservedPortsPropertyName = "reserved_ports" // reserved_ports = 22,2375-2377 never get allocated, node.<node id or name>.reserved_ports only on that node
+const NodePropertyPrefix = "node."                 // node.<node id>.<key> configs apply to a single node
+const MaxPortPropertyName = "max_port"             // Ports never get shifted past it
+const PortRangeSeparator = "-"
+
+// Where a port requested in topology.txt ended up
+type PortAllocation struct {
+	Node     string `json:"node"`
+	Port     int    `json:"port"`
+	Service  string `json:"service"`
+	Instance string `json:"instance"`
+	BasePort int    `json:"base_port"` // Port asked for in topology.txt
+	Shifted  bool   `json:"shifted"`   // Port != BasePort, the base port was taken or reserved
+}
+
+// Inclusive
+type portRange struct {
+	from int
+	to   int
+}
+
+// Hands out ports node by node, first come first served. Taken and reserved ports get bumped up to the next free one
+type portAllocator struct {
+	taken       map[string]string      // node:port -> instance holding it
+	reserved    map[string][]portRange // node -> its reserved ports, "" for the ones reserved on every node
+	maxPort     int
+	claimed     map[string][]int // instance -> ports it got from the lock file
+	allocations []PortAllocation
+}
+
+func newPortAllocator() *portAllocator {
+	return &portAllocator{
+		taken:    make(map[string]string),
+		reserved: make(map[string][]portRange),
+		maxPort:  MaxPort,
+		claimed:  make(map[string][]int),
+	}
+}
+
+// Allocator with the reserved ports and max port of the topology config, and the reserved ports of nodes
+func portAllocatorFor(config Config, configFile string, nodes []NodeDef) (*portAllocator, error) {
+	allocator := newPortAllocator()
+	var errs ParseErrors
+	var parse = func(key string, value string, node string) {
+		if value == "" {
+			return
+		}
+		ranges, err := parsePortRanges(value)
+		if err != nil {
+			errs = append(errs, &ParseError{File: configFile, Text: value, Message: fmt.Sprintf("%s: %s", key, err)})
+			return
+		}
+		allocator.reserved[node] = append(allocator.reserved[node], ranges...)
+	}
+	parse(ReservedPortsPropertyName, config.GetString(ReservedPortsPropertyName, ""), "")
+	for _, node := range nodes {
+		key := fmt.Sprintf("%s%d.%s", NodePropertyPrefix, node.ID, ReservedPortsPropertyName)
+		parse(key, node.Attributes[ReservedPortsPropertyName], node.Name)
+	}
+	if value := config.GetString(MaxPortPropertyName, ""); value != "" {
+		maxPort, err := strconv.Atoi(value)
+		if err != nil || maxPort < MinPort || maxPort > MaxPort {
+			errs = append(errs, &ParseError{File: configFile, Text: value,
+				Message: fmt.Sprintf("%s needs to be a port, between %d and %d", MaxPortPropertyName, MinPort, MaxPort)})
+		} else {
+			allocator.maxPort = maxPort
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return allocator, nil
+}
+
+// 22,2375-2377 -> [22-22, 2375-2377]
+func parsePortRanges(value string) ([]portRange, error) {
+	var res []portRange
+	for _, part := range strings.Split(value, ValueSeparator) {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, PortRangeSeparator, 2)
+		from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		to := from
+		if err == nil && len(bounds) == 2 {
+			to, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		}
+		if err != nil || from < MinPort || to > MaxPort || from > to {
+			return nil, fmt.Errorf("'%s' isn't a port or a port range, as in 22 or 2375-2377", part)
+		}
+		res = append(res, portRange{from: from, to: to})
+	}
+	return res, nil
+}
+
+func (allocator *portAllocator) isReserved(node string, port int) bool {
+	for _, ranges := range [][]portRange{allocator.reserved[""], allocator.reserved[node]} {
+		for _, reserved := range ranges {
+			if port >= reserved.from && port <= reserved.to {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (allocator *portAllocator) allocatePorts(basePorts []int, node string, service string, instance string, fixed bool) ([]int, error) {
+	if claimed, exists := allocator.claimed[instance]; exists {
+		return claimed, nil
+	}
+	ports := make([]int, len(basePorts))
+	for idx, basePort := range basePorts {
+		port, err := allocator.allocatePort(basePort, node, service, instance, fixed)
+		if err != nil {
+			return nil, err
+		}
+		ports[idx] = port
+	}
+	return ports, nil
+}
+
+// Errors are ParseErrors that don't know where they come from
+func (allocator *portAllocator) allocatePort(basePort int, node string, service string, instance string, fixed bool) (int, error) {
+	if basePort > allocator.maxPort {
+		return 0, &ParseError{
+			Message: fmt.Sprintf("port %d of '%s' is above %s %d", basePort, instance, MaxPortPropertyName, allocator.maxPort),
+			Hint:    fmt.Sprintf("lower the port or raise %s", MaxPortPropertyName),
+		}
+	}
+	port := basePort
+	for port <= allocator.maxPort && (allocator.taken[portKey(node, port)] != "" || allocator.isReserved(node, port)) {
+		if fixed && allocator.isReserved(node, port) {
+			return 0, &ParseError{
+				Message: fmt.Sprintf("port %d of '%s' is fixed but reserved on %s", basePort, instance, node),
+				Hint:    fmt.Sprintf("change it or drop %s from its service config", FixedPortsPropertyName),
+			}
+		}
+		if fixed {
+			return 0, &ParseError{
+				Message: fmt.Sprintf("port %d of '%s' is fixed but %s already has it on %s",
+					basePort, instance, allocator.taken[portKey(node, port)], node),
+				Hint: fmt.Sprintf("move one of them or drop %s from its service config", FixedPortsPropertyName),
+			}
+		}
+		port += 1
+	}
+	if port > allocator.maxPort {
+		return 0, &ParseError{
+			Message: fmt.Sprintf("no free port left for port %d of '%s' on %s, up to %s %d",
+				basePort, instance, node, MaxPortPropertyName, allocator.maxPort),
+			Hint: fmt.Sprintf("lower the port, raise %s or free up %s", MaxPortPropertyName, ReservedPortsPropertyName),
+		}
+	}
+	allocator.take(node, port, service, instance, basePort)
+	return port, nil
+}
+
+func (allocator *portAllocator) take(node string, port int, service string, instance string, basePort int) {
+	allocator.taken[portKey(node, port)] = instance
+	allocator.allocations = append(allocator.allocations, PortAllocation{
+		Node:     node,
+		Port:     port,
+		Service:  service,
+		Instance: instance,
+		BasePort: basePort,
+		Shifted:  port != basePort,
+	})
+}
+
+// Allocations sorted by node, then port
+func (allocator *portAllocator) report() []PortAllocation {
+	res := append([]PortAllocation{}, allocator.allocations...)
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Node != res[j].Node {
+			return res[i].Node < res[j].Node
+		}
+		return res[i].Port < res[j].Port
+	})
+	return res
+}
+
+func portKey(node string, port int) string {
+	return fmt.Sprintf("%s:%d", node, port)
+}
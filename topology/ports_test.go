@@ -0,0 +1,83 @@
+package topology
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPortAllocations(t *testing.T) {
+	topology, err := BuildTopologyFromString(NewTopologyContext("testdata"),
+		"node_count = 2\nkafka_cfg = 1,2:9092\nzookeeper_cfg = 1:9092,2181")
+	handleTestingError(err, t)
+	expected := []PortAllocation{
+		{Node: "dev-node01", Port: 2181, Service: "zookeeper", Instance: "zookeeper-01", BasePort: 2181},
+		{Node: "dev-node01", Port: 9092, Service: "kafka", Instance: "kafka-01", BasePort: 9092},
+		{Node: "dev-node01", Port: 9093, Service: "zookeeper", Instance: "zookeeper-01", BasePort: 9092, Shifted: true},
+		{Node: "dev-node02", Port: 9092, Service: "kafka", Instance: "kafka-02", BasePort: 9092},
+	}
+	allocations := topology.PortAllocations()
+	MustBeInt(len(expected), len(allocations), "allocation count", t)
+	for idx := 0; idx < len(expected) && idx < len(allocations); idx++ {
+		MustBeString(fmt.Sprint(expected[idx]), fmt.Sprint(allocations[idx]), "allocation", t)
+	}
+}
+
+func TestFixedPorts(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"services/zookeeper/service.config": "fixed_ports = true"}, t)
+	defer cleanup()
+
+	_, err := BuildTopologyFromString(ctx, "node_count = 2\nkafka_cfg = 1:2181\nzookeeper_cfg = 2,1:2181")
+	MustBeString(fmt.Sprintf("%s:3: port 2181 of 'zookeeper-02' is fixed but kafka-01 already has it on dev-node01 "+
+		"(move one of them or drop fixed_ports from its service config)", ctx.TopologyFile), fmt.Sprint(err), "error", t)
+}
+
+func TestReservedPorts(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{
+		"topology.config": "reserved_ports = 9092-9093, 9100\nnode.2.reserved_ports = 9094",
+	}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 2\nkafka_cfg = 1,2:9092,9100", t)
+	kafka, _ := topology.Service("kafka")
+	MustBeString("[9094 9101]", fmt.Sprint(kafka.Instances[0].Ports), "node 1 ports", t)
+	MustBeString("[9095 9101]", fmt.Sprint(kafka.Instances[1].Ports), "node 2 ports", t)
+}
+
+func TestReservedPortsByNodeName(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"topology.config": "node.beta.reserved_ports = 9092"}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "nodes = alpha,beta\nnode.alpha.reserved_ports = 9092-9093\nkafka_cfg = 1,2:9092", t)
+	kafka, _ := topology.Service("kafka")
+	MustBeString("[9094]", fmt.Sprint(kafka.Instances[0].Ports), "alpha ports", t)
+	MustBeString("[9093]", fmt.Sprint(kafka.Instances[1].Ports), "beta ports", t)
+}
+
+func TestPortsExhausted(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"topology.config": "reserved_ports = 9093\nmax_port = 9093"}, t)
+	defer cleanup()
+
+	_, err := BuildTopologyFromString(ctx, "node_count = 1\nkafka_cfg = 1,1:9092")
+	MustBeString(fmt.Sprintf("%s:2: no free port left for port 9092 of 'kafka-02' on dev-node01, up to max_port 9093 "+
+		"(lower the port, raise max_port or free up reserved_ports)", ctx.TopologyFile), fmt.Sprint(err), "error", t)
+}
+
+func TestPortAboveMaxPort(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"topology.config": "max_port = 9000"}, t)
+	defer cleanup()
+
+	_, err := BuildTopologyFromString(ctx, "node_count = 1\nkafka_cfg = 1:9092")
+	MustBeString(fmt.Sprintf("%s:2: port 9092 of 'kafka-01' is above max_port 9000 (lower the port or raise max_port)",
+		ctx.TopologyFile), fmt.Sprint(err), "error", t)
+}
+
+func TestParsePortRanges(t *testing.T) {
+	ranges, err := parsePortRanges("22, 2375-2377")
+	handleTestingError(err, t)
+	MustBeString("[{22 22} {2375 2377}]", fmt.Sprint(ranges), "ranges", t)
+	for _, value := range []string{"ssh", "2377-2375", "0", "22-70000", "22,"} {
+		if _, err := parsePortRanges(value); err == nil {
+			t.Errorf("'%s' should not parse", value)
+		}
+	}
+}
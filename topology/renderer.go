@@ -1,22 +1,27 @@
-package main
+package topology
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"regexp"
-	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 )
 
-func RenderServiceTemplate(fileName string, serviceName string, topology map[string]interface{}) ([]string, error) {
+func RenderServiceTemplate(fileName string, serviceName string, topology TopologyView) ([]string, error) {
+	service, exists := topology[serviceName].(ServiceView)
+	if !exists {
+		return nil, fmt.Errorf("unknown service '%s' rendering: %s", serviceName, fileName)
+	}
 	data := make(map[string]interface{})
 	data["topology"] = topology
-	data["service"] = topology[serviceName]
-	serviceConfigMap := data["service"].(map[string]interface{})["config"].(map[string]interface{})
+	data["service"] = service
+	serviceConfigMap := service["config"].(map[string]interface{})
 	if strings.Contains(fileName, "~") {
 		var res []string
-		for _, instance := range topology[serviceName].(map[string]interface{})["instances"].([]interface{}) {
+		for _, instance := range service["instances"].([]InstanceView) {
 			data["instance"] = instance
 			tmp, err := RenderTemplateFile(fileName, data)
 			if err != nil {
@@ -32,26 +37,71 @@ func RenderServiceTemplate(fileName string, serviceName string, topology map[str
 }
 
 func RenderGlobalTemplate(fileName string, topology Topology) (string, error) {
-	var services []interface{}
-	for _, serviceDef := range topology.serviceMetadata {
-		services = append(services, topology.dataMap[serviceDef.Name])
-	}
 	data := map[string]interface{}{}
-	tmp := topology.dataMap
 	// Ability to range over a service collection, they're originally root nodes
-	tmp["services"] = services
-	data["topology"] = tmp
+	view, err := topology.data.withServices(topology.services)
+	if err != nil {
+		return "", err
+	}
+	data["topology"] = view
 
 	return RenderTemplateFile(fileName, data)
 }
 
+// Mode of the files rendered out of templateFilePath, the first one found of:
+//  1. file_mode.<relPath> in config, e.g. file_mode.bin/pre-deploy.sh = 0755, relPath being the template path
+//     without .tmpl, relative to the service folder (service config) or topology folder (topology config)
+//  2. a {{/* mode: 0755 */}} comment opening the template
+//  3. the mode of the template file itself
+func renderedFileMode(templateFilePath string, relPath string, config Config) (os.FileMode, error) {
+	if configMode := config.GetString(FileModeConfigPrefix+relPath, ""); configMode != "" {
+		mode, err := parseFileMode(configMode)
+		if err != nil {
+			return 0, fmt.Errorf("%s%s: %w", FileModeConfigPrefix, relPath, err)
+		}
+		return mode, nil
+	}
+	content, err := readTextFile(templateFilePath)
+	if err != nil {
+		return 0, err
+	}
+	if match := fileModeFrontMatter.FindStringSubmatch(content); match != nil {
+		mode, err := parseFileMode(match[1])
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", templateFilePath, err)
+		}
+		return mode, nil
+	}
+	info, err := os.Stat(templateFilePath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Mode().Perm(), nil
+}
+
+var fileModeFrontMatter = regexp.MustCompile(`^{{-?\s*/\*\s*mode\s*:\s*(\S+)\s*\*/\s*-?}}`)
+
+func parseFileMode(mode string) (os.FileMode, error) {
+	res, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || res > 0777 {
+		return 0, fmt.Errorf("file mode needs to be octal, between 0000 and 0777: '%s'", mode)
+	}
+	return os.FileMode(res), nil
+}
+
 func RenderTemplateFile(fileName string, data map[string]interface{}) (string, error) {
-	tpl := template.Must(template.New(path.Base(fileName)).Funcs(funcMap()).ParseFiles(fileName))
+	tpl, err := template.New(path.Base(fileName)).Funcs(funcMap()).ParseFiles(fileName)
+	if err != nil {
+		return "", err
+	}
 	return doRender(*tpl, data)
 }
 
 func RenderTemplateString(templateContent string, data map[string]interface{}) (string, error) {
-	tpl := template.Must(template.New("").Funcs(funcMap()).Parse(templateContent))
+	tpl, err := template.New("").Funcs(funcMap()).Parse(templateContent)
+	if err != nil {
+		return "", err
+	}
 	return doRender(*tpl, data)
 }
 
@@ -72,7 +122,8 @@ func replacePlaceholders(content string, config map[string]interface{}) string {
 			spacePrefix = spacePrefixMatch[1]
 		}
 		var varMatches []string
-		for varMatch := range config {
+		// Config keys in order, so vars come out in the same order every render
+		for _, varMatch := range sortedKeys(config) {
 			if strings.HasPrefix(varMatch, prefix) {
 				//println(config[varMatch].(string))
 				varName := strings.ReplaceAll(varMatch, prefix, "")
@@ -81,7 +132,6 @@ func replacePlaceholders(content string, config map[string]interface{}) string {
 			}
 		}
 		if len(varMatches) > 0 {
-			sort.Strings(varMatches)
 			content = lineMatcher.ReplaceAllString(content, strings.Join(varMatches, "\n"))
 		}
 	}
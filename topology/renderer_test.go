@@ -0,0 +1,95 @@
+package topology
+
+import (
+	"testing"
+)
+
+func TestRenderTemplateStringHelpers(t *testing.T) {
+	data := map[string]interface{}{
+		"service": newServiceView(ServiceDef{
+			Name: "zookeeper",
+			Instances: []InstanceDef{
+				{ID: "01", Index: 0, Node: "dev-node01", Name: "zookeeper-01", Ports: []int{2181, 2888, 3888}},
+				{ID: "02", Index: 1, Node: "dev-node02", Name: "zookeeper-02", Ports: []int{2181, 2888, 3888}},
+			},
+			Config: map[string]string{},
+		}, nil),
+	}
+	res, err := RenderTemplateString(`{{ join "," (with_port 0 .service.instances) }}`, data)
+	handleTestingError(err, t)
+	MustBeString("dev-node01:2181,dev-node02:2181", res, "with_port", t)
+
+	res, err = RenderTemplateString(`{{ range .service.instances }}{{ mul .index 10 }} {{ idx 2 .ports }} {{ end }}`, data)
+	handleTestingError(err, t)
+	MustBeString("0 3888 10 3888 ", res, "mul and idx", t)
+
+	for _, badTemplate := range []string{
+		`{{ join "," (with_port 3 .service.instances) }}`,
+		`{{ idx 5 .service.instances }}`,
+		`{{ with_port 0 .service.name }}`,
+		`{{ range .service.instances }`,
+	} {
+		if _, err := RenderTemplateString(badTemplate, data); err == nil {
+			t.Errorf("'%s' should fail to render", badTemplate)
+		}
+	}
+}
+
+func TestRenderNamedPorts(t *testing.T) {
+	data := map[string]interface{}{
+		"service": newServiceView(ServiceDef{
+			Name: "zookeeper",
+			Instances: []InstanceDef{
+				{ID: "01", Index: 0, Node: "dev-node01", Name: "zookeeper-01", Ports: []int{2181, 2888, 3888}},
+				{ID: "02", Index: 1, Node: "dev-node01", Name: "zookeeper-02", Ports: []int{2182, 2889, 3889}},
+			},
+			PortNames: []string{"client", "peer", "election"},
+			Config:    map[string]string{},
+		}, nil),
+	}
+	res, err := RenderTemplateString(`{{ range .service.instances }}{{ .named_ports.client }} {{ idx 1 .ports }} {{ idx "election" .named_ports }} {{ end }}`, data)
+	handleTestingError(err, t)
+	MustBeString("2181 2888 3888 2182 2889 3889 ", res, "ports by name and index", t)
+
+	res, err = RenderTemplateString(`{{ join " " (with_2ports "peer" 2 .service.instances) }} {{ join "," (idx 0 .service.instances).ports }}`, data)
+	handleTestingError(err, t)
+	MustBeString("dev-node01:2888:3888 dev-node01:2889:3889 2181,2888,3888", res, "helpers", t)
+
+	// Names work on the ports list too
+	res, err = RenderTemplateString(`{{ range .service.instances }}{{ idx "client" .ports }} {{ mul (idx "peer" .ports) 1 }} {{ end }}`+
+		`{{ range (idx 0 .service.instances).ports }}{{ .name }}={{ .port }} {{ end }}`, data)
+	handleTestingError(err, t)
+	MustBeString("2181 2888 2182 2889 client=2181 peer=2888 election=3888 ", res, "ports list by name", t)
+
+	// Ranging sees each port once
+	res, err = RenderTemplateString(`{{ range (idx 0 .service.instances).ports }}{{ . }} {{ end }}`+
+		`{{ range $name, $port := (idx 0 .service.instances).named_ports }}{{ $name }}={{ $port }} {{ end }}`, data)
+	handleTestingError(err, t)
+	MustBeString("2181 2888 3888 client=2181 election=3888 peer=2888 ", res, "ranges", t)
+
+	for _, badTemplate := range []string{
+		`{{ join "," (with_port "admin" .service.instances) }}`,
+		`{{ idx "admin" (idx 0 .service.instances).named_ports }}`,
+		`{{ idx "admin" (idx 0 .service.instances).ports }}`,
+	} {
+		if _, err := RenderTemplateString(badTemplate, data); err == nil {
+			t.Errorf("'%s' should fail to render", badTemplate)
+		}
+	}
+}
+
+// Vars come in key order, the rest is as it always was: placeholder lines all get the vars of the first one, the
+// prefix is dropped wherever it is in the key and a $ in values gets expanded
+func TestReplacePlaceholders(t *testing.T) {
+	config := map[string]interface{}{
+		"ENV_B":          "2",
+		"ENV_A":          "1",
+		"ENV_C":          "$3",
+		"ENV_JAVA_ENV_X": "x",
+		"OTHER_A":        "a",
+	}
+	MustBeString("environment:\n  A: 1\n  B: 2\n  C: \n  JAVA_X: x\n",
+		replacePlaceholders("environment:\n  ENV_LAZY_PLACEHOLDER\n", config), "placeholder", t)
+	MustBeString("environment:\n  A: 1\n  B: 2\n  C: \n  JAVA_X: x\n  A: 1\n  B: 2\n  C: \n  JAVA_X: x\n",
+		replacePlaceholders("environment:\n  ENV_LAZY_PLACEHOLDER\n  OTHER_LAZY_PLACEHOLDER\n", config), "placeholders", t)
+}
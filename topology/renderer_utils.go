@@ -0,0 +1,193 @@
+package topology
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+func funcMap() template.FuncMap {
+	return template.FuncMap{
+		"nodes":                    nodes,
+		"hosts_with_ports":         hostsWithPorts,
+		"join":                     join,
+		"with_port":                withPort,
+		"with_port_and_prefix":     withPortAndPrefix,
+		"http_with_port":           httpWithPort,
+		"http_with_port_and_query": httpWithPortAndQuery,
+		"https_with_port":          httpsWithPort,
+		"with_2ports":              with2Ports,
+		"idx":                      idx,
+		"get":                      get,
+		"grep_key":                 grepKey,
+		"grep_1st_value":           grep1stValue,
+		"mul":                      mul,
+	}
+}
+
+
+func mul(values ...int) int {
+	res := 1
+	for _, tmp := range values {
+		res *= tmp
+	}
+	return res
+}
+
+// Ports are indexes or, for services naming their ports, names. So are the ports of the other helpers
+func hostsWithPorts(instances []InstanceView, portIndexes ...interface{}) ([]interface{}, error) {
+	res := make([]interface{}, len(instances))
+	for idx, instance := range instances {
+		ports := make([]string, len(portIndexes))
+		for portIdx, value := range portIndexes {
+			intPort, err := instancePort(instance, value)
+			if err != nil {
+				return nil, err
+			}
+			ports[portIdx] = fmt.Sprintf("%d", intPort)
+		}
+		portsString := strings.Join(ports, ":")
+		res[idx] = fmt.Sprintf("%s:%s", instance.node(), portsString)
+	}
+	return res, nil
+}
+
+func withPort(portIndex interface{}, instances []InstanceView) ([]interface{}, error) {
+	return urlWithPort("", "", portIndex, instances)
+}
+
+func httpWithPort(portIndex interface{}, instances []InstanceView) ([]interface{}, error) {
+	return urlWithPort("http://", "", portIndex, instances)
+}
+
+func httpsWithPort(portIndex interface{}, instances []InstanceView) ([]interface{}, error) {
+	return urlWithPort("https://", "", portIndex, instances)
+}
+
+func httpWithPortAndQuery(portIndex interface{}, queryString string, instances []InstanceView) ([]interface{}, error) {
+	return urlWithPort("http://", queryString, portIndex, instances)
+}
+
+func withPortAndPrefix(portIndex interface{}, prefix string, instances []InstanceView) ([]interface{}, error) {
+	return urlWithPort(prefix, "", portIndex, instances)
+}
+
+func urlWithPort(httpPrefix string, querySuffix string, portIndex interface{}, instances []InstanceView) ([]interface{}, error) {
+	res := make([]interface{}, len(instances))
+	for idx, instance := range instances {
+		intPort, err := instancePort(instance, portIndex)
+		if err != nil {
+			return nil, err
+		}
+		res[idx] = fmt.Sprintf("%s%s:%d%s", httpPrefix, instance.node(), intPort, querySuffix)
+	}
+	return res, nil
+}
+
+func nodes(instances []InstanceView) []interface{} {
+	res := make([]interface{}, len(instances))
+	for idx, instance := range instances {
+		res[idx] = instance.node()
+	}
+	return res
+}
+
+// Works on any list: instances, node names, helper results... and on ports and named ports, by name too
+func idx(item interface{}, items interface{}) (interface{}, error) {
+	if ports, isPorts := items.(PortsView); isPorts {
+		return ports.port(item)
+	}
+	if namedPorts, isNamed := items.(NamedPortsView); isNamed {
+		port, exists := namedPorts[fmt.Sprint(item)]
+		if !exists {
+			return nil, fmt.Errorf("no port named %v, named ports are: %v", item, map[string]int(namedPorts))
+		}
+		return port, nil
+	}
+	itemIndex, isIndex := item.(int)
+	if !isIndex {
+		return nil, fmt.Errorf("idx needs an index for lists, got: %v", item)
+	}
+	list := reflect.ValueOf(items)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil, fmt.Errorf("idx needs a list, got: %T", items)
+	}
+	if itemIndex < 0 || itemIndex >= list.Len() {
+		return nil, fmt.Errorf("index %d out of bounds, list has %d items", itemIndex, list.Len())
+	}
+	return list.Index(itemIndex).Interface(), nil
+}
+
+func get(key string, data map[string]interface{}) interface{} {
+	return data[key]
+}
+
+func with2Ports(port1 interface{}, port2 interface{}, instances []InstanceView) ([]interface{}, error) {
+	return hostsWithPorts(instances, port1, port2)
+}
+
+// Works on any list: helper results, node names, ports...
+func join(sep string, items interface{}) (string, error) {
+	list := reflect.ValueOf(items)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return "", fmt.Errorf("join needs a list, got: %T", items)
+	}
+	str := make([]string, list.Len())
+	for idx := 0; idx < list.Len(); idx++ {
+		str[idx] = fmt.Sprintf("%v", list.Index(idx).Interface())
+	}
+	return strings.Join(str, sep), nil
+}
+
+// Values in key order
+func grepKey(containing string, data map[string]interface{}) []interface{} {
+	var res []interface{}
+	for _, key := range sortedKeys(data) {
+		if strings.Contains(key, containing) {
+			res = append(res, data[key])
+		}
+	}
+	return res
+}
+
+// Values in key order
+func grep1stValue(containing string, data map[string]interface{}) []interface{} {
+	var res []interface{}
+	for _, key := range sortedKeys(data) {
+		tmp := fmt.Sprintf("%v", data[key])
+		if strings.Contains(tmp, containing) {
+			res = append(res, data[key])
+		}
+	}
+	return res
+}
+
+// Map iteration order is random, ranging over sorted keys keeps rendered output the same from one render to the next
+func sortedKeys(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func instancePort(instance InstanceView, port interface{}) (int, error) {
+	res, err := instance["ports"].(PortsView).port(port)
+	if err != nil {
+		return 0, fmt.Errorf("'%s': %s", instance["name"], err)
+	}
+	return res, nil
+}
+
+func doRender(tpl template.Template, data map[string]interface{}) (string, error) {
+	res := bytes.Buffer{}
+	err := tpl.Execute(&res, data)
+	if err != nil {
+		return "", err
+	}
+	return res.String(), nil
+}
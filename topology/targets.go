@@ -0,0 +1,162 @@
+package topology
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const TargetsPropertyName = "targets" // targets = swarm,compose picks the output targets, in the order they run
+const SwarmTarget = "swarm"
+const ComposeTarget = "compose"
+const K8sTarget = "k8s"
+const AnsibleTarget = "ansible"
+const TerraformTarget = "terraform"
+const DefaultTargets = SwarmTarget
+
+// Renders the topology into something deployable, next to the service and bin templates every render gets.
+// For every render a fresh target gets Prepare called once, then Service for every service followed by Instance
+// for each of its instances, in topology order, and Finalize once. Embed BaseTarget to only implement some
+type OutputTarget interface {
+	Prepare(ctx TopologyContext, topology Topology) error
+	Service(ctx TopologyContext, topology Topology, service ServiceDef) error
+	Instance(ctx TopologyContext, topology Topology, service ServiceDef, instance InstanceDef) error
+	Finalize(ctx TopologyContext, topology Topology) error
+}
+
+// Optionally implemented by targets rendering some service templates themselves, swarm-service fragments for
+// instance. relPath is relative to the service folder, claimed templates don't get rendered into deploy/<service>
+type TemplateClaimer interface {
+	ClaimsTemplate(relPath string) bool
+}
+
+func claimedByTarget(targets []OutputTarget, relPath string) bool {
+	for _, target := range targets {
+		if claimer, ok := target.(TemplateClaimer); ok && claimer.ClaimsTemplate(relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// No op OutputTarget hooks
+type BaseTarget struct{}
+
+func (BaseTarget) Prepare(ctx TopologyContext, topology Topology) error {
+	return nil
+}
+
+func (BaseTarget) Service(ctx TopologyContext, topology Topology, service ServiceDef) error {
+	return nil
+}
+
+func (BaseTarget) Instance(ctx TopologyContext, topology Topology, service ServiceDef, instance InstanceDef) error {
+	return nil
+}
+
+func (BaseTarget) Finalize(ctx TopologyContext, topology Topology) error {
+	return nil
+}
+
+var outputTargets = map[string]func() OutputTarget{}
+
+// Makes a target available to the targets topology config under name. Meant to be called from init,
+// registering a name twice panics
+func RegisterTarget(name string, newTarget func() OutputTarget) {
+	if _, exists := outputTargets[name]; exists {
+		panic(fmt.Sprintf("output target '%s' registered twice", name))
+	}
+	outputTargets[name] = newTarget
+}
+
+// Registered target names, sorted
+func TargetNames() []string {
+	var res []string
+	for name := range outputTargets {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func init() {
+	RegisterTarget(SwarmTarget, func() OutputTarget { return &swarmTarget{stacks: map[string]string{}} })
+	RegisterTarget(ComposeTarget, func() OutputTarget { return &composeTarget{} })
+	RegisterTarget(K8sTarget, func() OutputTarget { return &k8sTarget{} })
+	RegisterTarget(AnsibleTarget, func() OutputTarget { return &ansibleTarget{} })
+	RegisterTarget(TerraformTarget, func() OutputTarget { return &terraformTarget{} })
+}
+
+// Names of the targets the topology config asks for
+func (topology Topology) targetNames() []string {
+	var res []string
+	for _, name := range strings.Split(topology.metadata.Config.GetString(TargetsPropertyName, DefaultTargets), ValueSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+func (topology Topology) hasTarget(name string) bool {
+	for _, targetName := range topology.targetNames() {
+		if targetName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// New instances of the targets the topology config asks for
+func (topology Topology) outputTargets() ([]OutputTarget, error) {
+	var res []OutputTarget
+	for _, name := range topology.targetNames() {
+		newTarget, exists := outputTargets[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown output target '%s' in %s, known ones are: %s",
+				name, TargetsPropertyName, strings.Join(TargetNames(), ", "))
+		}
+		res = append(res, newTarget())
+	}
+	return res, nil
+}
+
+func renderTargets(ctx TopologyContext, topology Topology) error {
+	targets, err := topology.outputTargets()
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		err = target.Prepare(ctx, topology)
+		if err != nil {
+			return err
+		}
+		for _, serviceDef := range topology.servicesInDeployOrder() {
+			err = target.Service(ctx, topology, serviceDef)
+			if err != nil {
+				return err
+			}
+			for _, instanceDef := range serviceDef.Instances {
+				err = target.Instance(ctx, topology, serviceDef, instanceDef)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		err = target.Finalize(ctx, topology)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Metadata the service got built from
+func (topology Topology) serviceMetadataOf(serviceDef ServiceDef) ServiceMetadata {
+	for _, serviceMetadata := range topology.serviceMetadata {
+		if serviceMetadata.Name == serviceDef.Name {
+			return serviceMetadata
+		}
+	}
+	return ServiceMetadata{Name: serviceDef.Name}
+}
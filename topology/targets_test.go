@@ -0,0 +1,101 @@
+package topology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Records the hooks it gets called with
+type recordingTarget struct {
+	BaseTarget
+	calls *[]string
+}
+
+func (target recordingTarget) Prepare(ctx TopologyContext, topology Topology) error {
+	*target.calls = append(*target.calls, "prepare")
+	return nil
+}
+
+func (target recordingTarget) Service(ctx TopologyContext, topology Topology, service ServiceDef) error {
+	*target.calls = append(*target.calls, service.Name)
+	return nil
+}
+
+func (target recordingTarget) Instance(ctx TopologyContext, topology Topology, service ServiceDef, instance InstanceDef) error {
+	*target.calls = append(*target.calls, instance.Name)
+	return nil
+}
+
+func (target recordingTarget) Finalize(ctx TopologyContext, topology Topology) error {
+	*target.calls = append(*target.calls, "finalize")
+	return nil
+}
+
+// Renders claimed.txt.tmpl of the services itself, or would
+type claimingTarget struct {
+	BaseTarget
+}
+
+func (target claimingTarget) ClaimsTemplate(relPath string) bool {
+	return relPath == "claimed.txt.tmpl"
+}
+
+func TestRenderTargets(t *testing.T) {
+	var calls []string
+	RegisterTarget("recording", func() OutputTarget { return recordingTarget{calls: &calls} })
+	defer delete(outputTargets, "recording")
+	ctx, cleanup := tempTopology(map[string]string{"topology.config": "targets = recording"}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 2\nkafka_cfg = 1,2:9092\nzookeeper_cfg = 2:2181", t)
+	err := renderTargets(ctx, *topology)
+	handleTestingError(err, t)
+	MustBeString("prepare kafka kafka-01 kafka-02 zookeeper zookeeper-01 finalize", strings.Join(calls, " "), "hooks", t)
+}
+
+func TestUnknownTarget(t *testing.T) {
+	ctx, cleanup := tempTopology(map[string]string{"topology.config": "targets = swarm, helm"}, t)
+	defer cleanup()
+
+	topology := buildTopology(ctx, "node_count = 1", t)
+	_, err := topology.outputTargets()
+	MustBeString("unknown output target 'helm' in targets, known ones are: ansible, compose, k8s, swarm, terraform",
+		fmt.Sprint(err), "error", t)
+}
+
+func TestTargetsClaimTemplates(t *testing.T) {
+	RegisterTarget("claiming", func() OutputTarget { return claimingTarget{} })
+	defer delete(outputTargets, "claiming")
+	ctx, cleanup := tempTopology(map[string]string{
+		"services/app/claimed.txt.tmpl":       "{{ .service.name }}",
+		"services/app/other.txt.tmpl":         "{{ .service.name }}",
+		"services/app/swarm-service.yml.tmpl": "app:\n  image: app",
+	}, t)
+	defer cleanup()
+	ctx.LockFile = ""
+
+	for targets, expected := range map[string]string{
+		"claiming":       "app/other.txt app/swarm-service.yml",
+		"swarm,claiming": "app/other.txt",
+		"swarm":          "app/claimed.txt app/other.txt",
+	} {
+		handleTestingError(ioutil.WriteFile(ctx.topologyConfigFile(), []byte("targets = "+targets), DefaultFileMode), t)
+		topology := buildTopology(ctx, "node_count = 1\napp_cfg = 1:8080", t)
+		ctx.DeployDir = path.Join(ctx.topologyDir(), DeployFolder, targets)
+		handleTestingError(Render(ctx, *topology), t)
+		tree, err := readTree(ctx.DeployDir)
+		handleTestingError(err, t)
+		var appFiles []string
+		for filePath := range tree {
+			if strings.HasPrefix(filePath, "app/") {
+				appFiles = append(appFiles, filePath)
+			}
+		}
+		sort.Strings(appFiles)
+		MustBeString(expected, strings.Join(appFiles, " "), "app files with targets "+targets, t)
+	}
+}
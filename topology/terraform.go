@@ -0,0 +1,77 @@
+package topology
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+const TerraformDeployFolder = "terraform"
+const TerraformVarsFile = "topology.auto.tfvars.json" // Picked up by terraform and tofu without a -var-file
+
+// What a node needs provisioned for, in topology.auto.tfvars.json
+type terraformNode struct {
+	Name     string              `json:"name"` // Its hostname, node.<node id>.hostname included
+	IP       string              `json:"ip"`   // Empty unless the topology gives it
+	Services []terraformInstance `json:"services"`
+	Ports    []int               `json:"ports"` // Every port allocated on the node, sorted, for security groups
+}
+
+type terraformInstance struct {
+	Service  string `json:"service"`
+	Instance string `json:"instance"`
+	Ports    []int  `json:"ports"`
+}
+
+// The variables a terraform module needs to size the cluster and open the allocated ports
+type terraformTarget struct {
+	BaseTarget
+}
+
+func (target *terraformTarget) Finalize(ctx TopologyContext, topology Topology) error {
+	vars, err := terraformVars(topology)
+	if err != nil {
+		return err
+	}
+	return ctx.appendToFile(ctx.terraformVarsFilePath(), vars)
+}
+
+func terraformVars(topology Topology) (string, error) {
+	nodes := make([]terraformNode, len(topology.metadata.Nodes))
+	nodeIdx := map[string]int{}
+	for idx, node := range topology.metadata.Nodes {
+		nodes[idx] = terraformNode{
+			Name:     node.Name,
+			IP:       node.IP,
+			Services: []terraformInstance{},
+			Ports:    []int{},
+		}
+		nodeIdx[node.Name] = idx
+	}
+	for _, serviceDef := range topology.services {
+		for _, instanceDef := range serviceDef.Instances {
+			node := &nodes[nodeIdx[instanceDef.Node]]
+			node.Services = append(node.Services, terraformInstance{
+				Service:  serviceDef.Name,
+				Instance: instanceDef.Name,
+				Ports:    instanceDef.Ports,
+			})
+			node.Ports = append(node.Ports, instanceDef.Ports...)
+		}
+	}
+	for idx := range nodes {
+		sort.Ints(nodes[idx].Ports)
+	}
+	vars := map[string]interface{}{
+		NodeCountPropertyName: topology.metadata.NodeCount,
+		"nodes":               nodes,
+	}
+	// Listed nodes are named as they are, the prefix would only mislead a module naming them after it
+	if !topology.metadata.NodesListed {
+		vars[NodeNamePrefixPropertyName] = topology.metadata.Config.GetString(NodeNamePrefixPropertyName, DefaultNodeNamePrefix)
+	}
+	res, err := json.MarshalIndent(vars, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(res) + "\n", nil
+}
@@ -0,0 +1,98 @@
+package topology
+
+import "testing"
+
+func TestTerraformVars(t *testing.T) {
+	topology, err := BuildTopologyFromString(NewTopologyContext("testdata"),
+		"node_count = 3\nzookeeper_cfg = 1,1:2181\nkafka_cfg = 1:9092")
+	handleTestingError(err, t)
+	vars, err := terraformVars(*topology)
+	handleTestingError(err, t)
+	MustBeString(`{
+  "hostname_prefix": "dev",
+  "node_count": 3,
+  "nodes": [
+    {
+      "name": "dev-node01",
+      "ip": "",
+      "services": [
+        {
+          "service": "zookeeper",
+          "instance": "zookeeper-01",
+          "ports": [
+            2181
+          ]
+        },
+        {
+          "service": "zookeeper",
+          "instance": "zookeeper-02",
+          "ports": [
+            2182
+          ]
+        },
+        {
+          "service": "kafka",
+          "instance": "kafka-01",
+          "ports": [
+            9092
+          ]
+        }
+      ],
+      "ports": [
+        2181,
+        2182,
+        9092
+      ]
+    },
+    {
+      "name": "dev-node02",
+      "ip": "",
+      "services": [],
+      "ports": []
+    },
+    {
+      "name": "dev-node03",
+      "ip": "",
+      "services": [],
+      "ports": []
+    }
+  ]
+}
+`, vars, "topology.auto.tfvars.json", t)
+}
+
+func TestTerraformVarsListedNodes(t *testing.T) {
+	topology, err := BuildTopologyFromString(NewTopologyContext("testdata"),
+		"nodes = alpha,beta\nnode.beta.ip = 10.0.0.2\nkafka_cfg = 2:9092")
+	handleTestingError(err, t)
+	vars, err := terraformVars(*topology)
+	handleTestingError(err, t)
+	MustBeString(`{
+  "node_count": 2,
+  "nodes": [
+    {
+      "name": "alpha",
+      "ip": "",
+      "services": [],
+      "ports": []
+    },
+    {
+      "name": "beta",
+      "ip": "10.0.0.2",
+      "services": [
+        {
+          "service": "kafka",
+          "instance": "kafka-01",
+          "ports": [
+            9092
+          ]
+        }
+      ],
+      "ports": [
+        9092
+      ]
+    }
+  ]
+}
+`, vars, "topology.auto.tfvars.json", t)
+}
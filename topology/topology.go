@@ -0,0 +1,46 @@
+// Package topology builds a lazy topology out of a topology.txt, its topology.config and the service folders,
+// and renders its templates into a deploy folder.
+//
+//	ctx := topology.NewTopologyContext("path/to/topology/folder")
+//	t, err := topology.Load(ctx)
+//	...
+//	for _, service := range t.Services() {
+//		...
+//	}
+//	err = topology.Render(ctx, *t)
+package topology
+
+// Node names, in node id order. Node id 1 is the first one
+func (topology Topology) NodeNames() []string {
+	return topology.metadata.NodeNames
+}
+
+// Topology config, topology.config on top of the inherited one
+func (topology Topology) Config() Config {
+	return topology.metadata.Config
+}
+
+// Services in topology definition order, with their instances and allocated ports
+func (topology Topology) Services() []ServiceDef {
+	return topology.services
+}
+
+// Service by name, false if the topology doesn't define it
+func (topology Topology) Service(name string) (ServiceDef, bool) {
+	for _, serviceDef := range topology.services {
+		if serviceDef.Name == name {
+			return serviceDef, true
+		}
+	}
+	return ServiceDef{}, false
+}
+
+// Every allocated port, sorted by node then port
+func (topology Topology) PortAllocations() []PortAllocation {
+	return topology.ports
+}
+
+// What ends up in topology.json
+func (topology Topology) JSON() string {
+	return topology.jsonString
+}
@@ -0,0 +1,204 @@
+package topology
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Checks the topology in ctx without rendering and without git fetching, inherited packs have to be vendored already.
+// Parse errors stop it early, otherwise every problem found comes back in one ParseErrors:
+// services with no service folder, unknown output targets, template syntax errors and templates using config keys
+// that don't exist
+func Validate(ctx TopologyContext) error {
+	ctx.Offline = true
+	topology, err := Load(ctx)
+	if err != nil {
+		return err
+	}
+	var errs ParseErrors
+	for _, serviceMetadata := range topology.serviceMetadata {
+		if !exists(ctx.serviceDir(serviceMetadata.Name)) && !exists(ctx.inheritServiceDir(serviceMetadata.Name)) {
+			errs = append(errs, &ParseError{
+				File:    ctx.TopologyFile,
+				Line:    serviceMetadata.Line,
+				Message: fmt.Sprintf("service '%s' has no service folder", serviceMetadata.Name),
+				Hint: fmt.Sprintf("add %s or inherit one with '%s = ' in its service config",
+					ctx.serviceDir(serviceMetadata.Name), RootConfigName),
+			})
+		}
+	}
+
+	if _, err := topology.outputTargets(); err != nil {
+		errs = append(errs, &ParseError{File: ctx.topologyConfigFile(), Message: err.Error()})
+	}
+
+	var validateTemplate = func(scope templateScope) RenderTemplate {
+		return func(templateFilePath string) (string, error) {
+			errs = append(errs, validateTemplateFile(templateFilePath, scope)...)
+			return "", nil
+		}
+	}
+	// Non existing paths will be ignored
+	for _, serviceDef := range topology.services {
+		service := serviceDef
+		serviceScope := templateScope{topology: *topology, service: &service}
+		for _, serviceDir := range []string{ctx.inheritServiceDir(service.Name), ctx.serviceDir(service.Name)} {
+			_, err := withDirectory(serviceDir, validateTemplate(serviceScope))
+			if err != nil {
+				return err
+			}
+		}
+		// service configs are templates too, they only get to see the topology config
+		for _, configFile := range []string{ctx.inheritServiceConfigFile(service.Name), ctx.serviceConfigFilePath(service.Name)} {
+			if exists(configFile) {
+				errs = append(errs, validateTemplateFile(configFile, templateScope{topology: *topology})...)
+			}
+		}
+	}
+	for _, binDir := range []string{ctx.rootInheritBinFolder(), ctx.binDir()} {
+		_, err := withDirectory(binDir, validateTemplate(templateScope{topology: *topology}))
+		if err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// What a template gets rendered with, service is nil for global templates and service configs
+type templateScope struct {
+	topology Topology
+	service  *ServiceDef
+}
+
+// Config key the field chain points at, if it points at a config key that doesn't exist
+// .topology.config.key, .service.config.key and .topology.<service>.config.key are checked
+func (scope templateScope) missingConfigKey(ident []string) (string, bool) {
+	var config map[string]string
+	var what string
+	var key string
+	switch {
+	case len(ident) >= 3 && ident[0] == "topology" && ident[1] == "config":
+		config, what, key = scope.topology.Config().data, "topology config", ident[2]
+	case len(ident) >= 3 && ident[0] == "service" && ident[1] == "config" && scope.service != nil:
+		config, what, key = scope.service.Config, fmt.Sprintf("'%s' service config", scope.service.Name), ident[2]
+	case len(ident) >= 4 && ident[0] == "topology" && ident[2] == "config":
+		service, exists := scope.topology.Service(ident[1])
+		if !exists {
+			return "", false
+		}
+		config, what, key = service.Config, fmt.Sprintf("'%s' service config", service.Name), ident[3]
+	default:
+		return "", false
+	}
+	if _, exists := config[key]; exists {
+		return "", false
+	}
+	return fmt.Sprintf("%s key '%s' doesn't exist", what, key), true
+}
+
+var templateErrorMatcher = regexp.MustCompile(`^template: [^:]*:(\d+):\s*(.*)$`)
+
+func validateTemplateFile(templateFilePath string, scope templateScope) ParseErrors {
+	tpl, err := template.New(path.Base(templateFilePath)).Funcs(funcMap()).ParseFiles(templateFilePath)
+	if err != nil {
+		parseErr := &ParseError{File: templateFilePath, Message: err.Error()}
+		if match := templateErrorMatcher.FindStringSubmatch(err.Error()); match != nil {
+			parseErr.Line, _ = strconv.Atoi(match[1])
+			parseErr.Message = match[2]
+		}
+		return ParseErrors{parseErr}
+	}
+	source, err := readTextFile(templateFilePath)
+	if err != nil {
+		return ParseErrors{{File: templateFilePath, Message: err.Error()}}
+	}
+	sourceLines := strings.Split(source, "\n")
+	var errs ParseErrors
+	for _, tmpl := range tpl.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		tree := tmpl.Tree
+		walkTemplateNode(tree.Root, true, func(node parse.Node, ident []string) {
+			message, missing := scope.missingConfigKey(ident)
+			if !missing {
+				return
+			}
+			location, context := tree.ErrorContext(node)
+			parseErr := &ParseError{File: templateFilePath, Text: context, Message: message}
+			// location is name:line:column, column isn't where the field chain starts though, so look it up
+			position := strings.Split(location, ":")
+			if len(position) >= 3 {
+				parseErr.Line, _ = strconv.Atoi(position[len(position)-2])
+				if parseErr.Line <= len(sourceLines) {
+					parseErr.Column = strings.Index(sourceLines[parseErr.Line-1], context) + 1
+				}
+			}
+			errs = append(errs, parseErr)
+		})
+	}
+	return errs
+}
+
+// Visits every field chain relative to the template root: .a.b.c everywhere but in range and with
+// bodies, where dot is something else, and $.a.b.c everywhere
+func walkTemplateNode(node parse.Node, rootScope bool, visit func(node parse.Node, ident []string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateNode(child, rootScope, visit)
+		}
+	case *parse.ActionNode:
+		walkTemplateNode(n.Pipe, rootScope, visit)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkTemplateNode(cmd, rootScope, visit)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkTemplateNode(arg, rootScope, visit)
+		}
+	case *parse.FieldNode:
+		if rootScope {
+			visit(n, n.Ident)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			visit(n, n.Ident[1:])
+		}
+	case *parse.IfNode:
+		walkTemplateNode(n.Pipe, rootScope, visit)
+		walkTemplateNode(n.List, rootScope, visit)
+		walkTemplateNode(n.ElseList, rootScope, visit)
+	case *parse.RangeNode:
+		walkTemplateNode(n.Pipe, rootScope, visit)
+		walkTemplateNode(n.List, false, visit)
+		walkTemplateNode(n.ElseList, rootScope, visit)
+	case *parse.WithNode:
+		walkTemplateNode(n.Pipe, rootScope, visit)
+		walkTemplateNode(n.List, false, visit)
+		walkTemplateNode(n.ElseList, rootScope, visit)
+	case *parse.TemplateNode:
+		walkTemplateNode(n.Pipe, rootScope, visit)
+	}
+}
+
+func exists(filePath string) bool {
+	_, err := os.Stat(filePath)
+	return err == nil
+}
@@ -0,0 +1,35 @@
+package topology
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	err := Validate(NewTopologyContext("testdata"))
+	handleTestingError(err, t)
+}
+
+func TestValidateInvalid(t *testing.T) {
+	err := Validate(NewTopologyContext("testdata/invalid"))
+	errs, isParseErrors := err.(ParseErrors)
+	if !isParseErrors {
+		t.Fatalf("should fail with parse errors, err: %v", err)
+	}
+	expected := []string{
+		"testdata/invalid/topology.txt:3: service 'kafka' has no service folder " +
+			"(add testdata/invalid/services/kafka or inherit one with 'from = ' in its service config)",
+		"testdata/invalid/topology.config: unknown output target 'helm' in targets, " +
+			"known ones are: ansible, compose, k8s, swarm, terraform",
+		"testdata/invalid/services/zookeeper/broken.sh.tmpl:3: unclosed action started at broken.sh.tmpl:2",
+		"testdata/invalid/services/zookeeper/zoo~.cfg.tmpl:2:11: 'zookeeper' service config key 'log_folder' doesn't exist: " +
+			"'.service.config.log_folder'",
+		"testdata/invalid/services/zookeeper/zoo~.cfg.tmpl:4:66: topology config key 'peer_port' doesn't exist: " +
+			"'$.topology.config.peer_port'",
+		"testdata/invalid/services/zookeeper/service.config:1:18: topology config key 'data_folder' doesn't exist: " +
+			"'.topology.config.data_folder'",
+	}
+	MustBeInt(len(expected), len(errs), "error count", t)
+	for idx := 0; idx < len(expected) && idx < len(errs); idx++ {
+		MustBeString(expected[idx], errs[idx].Error(), "validation error", t)
+	}
+}
@@ -0,0 +1,174 @@
+package topology
+
+import "fmt"
+
+// What templates get to see. Views are maps so templates keep using the topology.json keys
+// (.instance.ports, .service.instances, .topology.config...), but values keep their Go types:
+// ports and indexes are ints, instance lists are []InstanceView, and so on.
+
+// .topology, service names are root keys next to node_count, config, node_names, nodes, stack_names and deploy_order
+type TopologyView map[string]interface{}
+
+// Root keys of .topology and topology.json that aren't services, services can't be named after them
+var ReservedServiceNames = []string{NodeCountPropertyName, "config", "node_names", NodesPropertyName, "stack_names", "deploy_order", "services"}
+
+// .service, keys: name, instances, port_names, depends_on, config
+type ServiceView map[string]interface{}
+
+// .instance, keys: ID, index, node, node_ip, node_labels, name, ports, port_names, named_ports
+type InstanceView map[string]interface{}
+
+// .topology.nodes items, keys: id, name, ip, labels, attributes
+type NodeView map[string]interface{}
+
+// .instance.ports, in order. idx gets ports out of it as ints, by index or, for services naming their ports, by name.
+// There's no .instance.ports.<name>, that's .instance.named_ports.<name>
+type PortsView []PortView
+
+// .instance.ports items, keys: port, name ("" for services not naming their ports). Prints as the port
+type PortView map[string]interface{}
+
+// .instance.named_ports, port name -> port for services naming their ports, empty otherwise
+type NamedPortsView map[string]int
+
+func newTopologyView(metadata TopologyMetadata, serviceDefs []ServiceDef, stackNames []string, deployOrder []string) TopologyView {
+	view := TopologyView{}
+	nodes := map[string]NodeDef{}
+	nodeViews := make([]NodeView, len(metadata.Nodes))
+	for idx, node := range metadata.Nodes {
+		nodes[node.Name] = node
+		nodeViews[idx] = newNodeView(node)
+	}
+	for _, serviceDef := range serviceDefs {
+		view[serviceDef.Name] = newServiceView(serviceDef, nodes)
+	}
+	view["node_count"] = metadata.NodeCount
+	view["config"] = configView(metadata.Config.data)
+	view["node_names"] = metadata.NodeNames
+	view["nodes"] = nodeViews
+	view["stack_names"] = stackNames
+	view["deploy_order"] = deployOrder
+	return view
+}
+
+func newNodeView(node NodeDef) NodeView {
+	return NodeView{
+		"id":         node.ID,
+		"name":       node.Name,
+		"ip":         node.IP,
+		"labels":     configView(node.Labels),
+		"attributes": configView(node.Attributes),
+	}
+}
+
+// nodes by name
+func newServiceView(serviceDef ServiceDef, nodes map[string]NodeDef) ServiceView {
+	instances := make([]InstanceView, len(serviceDef.Instances))
+	for idx, instanceDef := range serviceDef.Instances {
+		instances[idx] = newInstanceView(instanceDef, serviceDef.PortNames, nodes[instanceDef.Node])
+	}
+	return ServiceView{
+		"name":       serviceDef.Name,
+		"instances":  instances,
+		"port_names": serviceDef.PortNames,
+		"depends_on": serviceDef.DependsOn,
+		"config":     configView(serviceDef.Config),
+	}
+}
+
+func newInstanceView(instanceDef InstanceDef, portNames []string, node NodeDef) InstanceView {
+	ports := make(PortsView, len(instanceDef.Ports))
+	for idx, port := range instanceDef.Ports {
+		ports[idx] = PortView{"port": port, "name": ""}
+	}
+	namedPorts := NamedPortsView{}
+	for idx, name := range portNames {
+		namedPorts[name] = instanceDef.Ports[idx]
+		ports[idx]["name"] = name
+	}
+	return InstanceView{
+		"ID":          instanceDef.ID,
+		"index":       instanceDef.Index,
+		"node":        instanceDef.Node,
+		"node_ip":     node.IP,
+		"node_labels": configView(node.Labels),
+		"name":        instanceDef.Name,
+		"ports":       ports,
+		"port_names":  portNames,
+		"named_ports": namedPorts,
+	}
+}
+
+// Config values are strings, kept as interface{} so get, grep_key and grep_1st_value work on any config
+func configView(config map[string]string) map[string]interface{} {
+	res := map[string]interface{}{}
+	for key, value := range config {
+		res[key] = value
+	}
+	return res
+}
+
+// Shallow copy with the services list on top, global templates range over .topology.services
+func (view TopologyView) withServices(serviceDefs []ServiceDef) (TopologyView, error) {
+	res := TopologyView{}
+	for key, value := range view {
+		res[key] = value
+	}
+	services := make([]ServiceView, len(serviceDefs))
+	for idx, serviceDef := range serviceDefs {
+		service, isService := view[serviceDef.Name].(ServiceView)
+		if !isService {
+			return nil, fmt.Errorf("'%s' isn't a service of the topology view, got: %T", serviceDef.Name, view[serviceDef.Name])
+		}
+		services[idx] = service
+	}
+	res["services"] = services
+	return res, nil
+}
+
+func (view InstanceView) node() string {
+	return view["node"].(string)
+}
+
+func (view InstanceView) ports() []int {
+	ports := view["ports"].(PortsView)
+	res := make([]int, len(ports))
+	for idx, port := range ports {
+		res[idx] = port.port()
+	}
+	return res
+}
+
+// Port by index or name
+func (view PortsView) port(item interface{}) (int, error) {
+	if name, isName := item.(string); isName {
+		var names []string
+		for _, port := range view {
+			if port["name"] == name {
+				return port.port(), nil
+			}
+			names = append(names, port["name"].(string))
+		}
+		return 0, fmt.Errorf("no port named '%s', port names are: %v", name, names)
+	}
+	portIndex, isIndex := item.(int)
+	if !isIndex {
+		return 0, fmt.Errorf("port needs to be an index or a name, got: %v", item)
+	}
+	if portIndex < 0 || portIndex >= len(view) {
+		return 0, fmt.Errorf("port index %d out of bounds, there are %d ports", portIndex, len(view))
+	}
+	return view[portIndex].port(), nil
+}
+
+func (view PortView) port() int {
+	return view["port"].(int)
+}
+
+func (view PortView) String() string {
+	return fmt.Sprint(view.port())
+}
+
+func (view InstanceView) portNames() []string {
+	return view["port_names"].([]string)
+}